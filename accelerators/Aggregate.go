@@ -0,0 +1,74 @@
+// Package accelerators holds the aggregates that speed up ray intersection by
+// grouping primitives spatially. Every aggregate is itself a core.Primitive so
+// they can be nested, e.g. a BVH of instances that each hold their own BVH.
+package accelerators
+
+import "Anvil/core"
+
+// workers bounds the number of goroutines used while building an aggregate
+type workers struct {
+	sem chan struct{}
+}
+
+// the calling goroutine counts as one of the nThreads
+func newWorkers(nThreads int) *workers {
+	return &workers{make(chan struct{}, max(0, nThreads-1))}
+}
+
+// fork runs f on another goroutine if parallel is set and one is free, otherwise
+// it runs f right away. The returned function waits for f to be done
+func (w *workers) fork(parallel bool, f func()) (join func()) {
+	if parallel {
+		select {
+		case w.sem <- struct{}{}:
+			done := make(chan struct{})
+			go func() {
+				f()
+				<-w.sem
+				close(done)
+			}()
+			return func() { <-done }
+		default:
+		}
+	}
+	f()
+	return func() {}
+}
+
+// parallelFor calls f for every i in [0, n) splitting the range in one chunk per
+// thread, f must only write to state owned by its index
+func (w *workers) parallelFor(n int, f func(i int)) {
+	nChunks := cap(w.sem) + 1
+	chunk := (n + nChunks - 1) / nChunks
+	joins := make([]func(), 0, nChunks)
+	for start := 0; start < n; start += chunk {
+		end := min(start+chunk, n)
+		joins = append(joins, w.fork(end < n, func() {
+			for i := start; i < end; i++ {
+				f(i)
+			}
+		}))
+	}
+	for _, join := range joins {
+		join()
+	}
+}
+
+// the centroid of a bounding box, used to sort primitives during construction
+func centroid(b core.Bounds3) core.Point3 {
+	return b.Get(0).Multiply(0.5).AddP(b.Get(1).Multiply(0.5))
+}
+
+// rayInverse precomputes what Bounds3.IntersectPInv needs to test a ray
+// against many boxes. The sign comes from the reciprocal so a -0 component
+// counts as negative, matching its -Inf reciprocal
+func rayInverse(dir core.Vec3) (core.Vec3, [3]int) {
+	invDir := core.Vec3{X: 1 / dir.X, Y: 1 / dir.Y, Z: 1 / dir.Z}
+	var dirIsNeg [3]int
+	for i := 0; i < 3; i++ {
+		if invDir.Get(i) < 0 {
+			dirIsNeg[i] = 1
+		}
+	}
+	return invDir, dirIsNeg
+}
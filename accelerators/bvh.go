@@ -0,0 +1,420 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"math"
+	"sync/atomic"
+)
+
+// SplitMethod chooses how primitives are divided between the two children of a node
+type SplitMethod int
+
+const (
+	// SplitSAH minimizes the surface area heuristic cost estimate
+	SplitSAH SplitMethod = iota
+	// SplitMiddle splits at the midpoint of the centroid bounds
+	SplitMiddle
+	// SplitEqualCounts puts half of the primitives in each child
+	SplitEqualCounts
+	// SplitHLBVH sorts primitives along a Morton curve, it builds much faster
+	// than SAH at the cost of a somewhat worse tree
+	SplitHLBVH
+)
+
+// ParseSplitMethod maps the scene file names of the split methods
+func ParseSplitMethod(name string) (SplitMethod, bool) {
+	switch name {
+	case "sah":
+		return SplitSAH, true
+	case "middle":
+		return SplitMiddle, true
+	case "equal":
+		return SplitEqualCounts, true
+	case "hlbvh":
+		return SplitHLBVH, true
+	}
+	return SplitSAH, false
+}
+
+type bvhPrimitiveInfo struct {
+	primitiveNumber int
+	bounds          core.Bounds3
+	centroid        core.Point3
+}
+
+type bvhBuildNode struct {
+	bounds                                  core.Bounds3
+	children                                [2]*bvhBuildNode
+	splitAxis, firstPrimOffset, nPrimitives int
+}
+
+func newLeafNode(first, n int, b core.Bounds3) *bvhBuildNode {
+	return &bvhBuildNode{bounds: b, firstPrimOffset: first, nPrimitives: n}
+}
+
+func newInteriorNode(axis int, c0, c1 *bvhBuildNode) *bvhBuildNode {
+	return &bvhBuildNode{
+		bounds:    core.UnionB3B3(c0.bounds, c1.bounds),
+		children:  [2]*bvhBuildNode{c0, c1},
+		splitAxis: axis,
+	}
+}
+
+// The tree is flattened into an array in depth first order for traversal, the
+// first child of an interior node is the node right after it so only the offset
+// of the second child needs to be stored
+type linearBVHNode struct {
+	bounds core.Bounds3
+	// primitives offset for leaves, second child offset for interior nodes
+	offset      int32
+	nPrimitives uint16
+	axis        uint8
+}
+
+// BVHAccel is a bounding volume hierarchy over a list of primitives
+type BVHAccel struct {
+	maxPrimsInNode int
+	splitMethod    SplitMethod
+	primitives     []core.Primitive
+	nodes          []linearBVHNode
+}
+
+// NewBVHAccel builds the hierarchy using up to nThreads goroutines, normally
+// system.Options.Threads(). The tree only depends on the primitives and the
+// parameters so it is the same whatever the thread count
+func NewBVHAccel(prims []core.Primitive, maxPrimsInNode int, splitMethod SplitMethod, nThreads int) *BVHAccel {
+	b := &BVHAccel{
+		maxPrimsInNode: int(math.Min(255, math.Max(1, float64(maxPrimsInNode)))),
+		splitMethod:    splitMethod,
+		primitives:     prims,
+	}
+	if len(prims) == 0 {
+		return b
+	}
+
+	// Initialize primitive info array
+	w := newWorkers(nThreads)
+	info := make([]bvhPrimitiveInfo, len(prims))
+	w.parallelFor(len(prims), func(i int) {
+		bounds := prims[i].WorldBound()
+		info[i] = bvhPrimitiveInfo{i, bounds, centroid(bounds)}
+	})
+
+	// Build the tree, subtrees only reorder their own part of info so leaves can
+	// refer to primitives by their position in it no matter which goroutine
+	// builds them
+	var totalNodes int64
+	var root *bvhBuildNode
+	if splitMethod == SplitHLBVH {
+		root = b.hlbvhBuild(w, info, &totalNodes)
+	} else {
+		root = b.recursiveBuild(w, info, 0, &totalNodes)
+	}
+	orderedPrims := make([]core.Primitive, len(prims))
+	for i := range info {
+		orderedPrims[i] = prims[info[i].primitiveNumber]
+	}
+	b.primitives = orderedPrims
+
+	b.nodes = make([]linearBVHNode, totalNodes)
+	offset := 0
+	b.flattenBVHTree(root, &offset)
+	return b
+}
+
+// subtrees with fewer primitives than this aren't worth a goroutine
+const parallelBuildThreshold = 4096
+
+// recursiveBuild builds the subtree over info, which starts at position first of
+// the whole array
+func (b *BVHAccel) recursiveBuild(w *workers, info []bvhPrimitiveInfo, first int, totalNodes *int64) *bvhBuildNode {
+	atomic.AddInt64(totalNodes, 1)
+	bounds := core.NewEmptyBounds3()
+	for i := range info {
+		bounds = core.UnionB3B3(bounds, info[i].bounds)
+	}
+	if len(info) == 1 {
+		return newLeafNode(first, len(info), bounds)
+	}
+
+	// Choose split dimension, if all centroids are in the same spot there is
+	// nothing to split on
+	centroidBounds := core.NewEmptyBounds3()
+	for i := range info {
+		centroidBounds = core.UnionB3P(centroidBounds, info[i].centroid)
+	}
+	dim := centroidBounds.MaxExtent()
+	if centroidBounds.Get(1).Get(dim) == centroidBounds.Get(0).Get(dim) {
+		return newLeafNode(first, len(info), bounds)
+	}
+
+	mid := b.split(info, bounds, centroidBounds, dim)
+	if mid < 0 {
+		return newLeafNode(first, len(info), bounds)
+	}
+	var c0 *bvhBuildNode
+	join := w.fork(len(info) >= parallelBuildThreshold, func() {
+		c0 = b.recursiveBuild(w, info[:mid], first, totalNodes)
+	})
+	c1 := b.recursiveBuild(w, info[mid:], first+mid, totalNodes)
+	join()
+	return newInteriorNode(dim, c0, c1)
+}
+
+// split reorders info into the two children and returns where the second child
+// starts, or -1 if the primitives should stay together in a leaf
+func (b *BVHAccel) split(info []bvhPrimitiveInfo, bounds, centroidBounds core.Bounds3, dim int) int {
+	nPrimitives := len(info)
+	switch b.splitMethod {
+	case SplitMiddle:
+		pMid := (centroidBounds.Get(0).Get(dim) + centroidBounds.Get(1).Get(dim)) / 2
+		mid := partitionInfo(info, func(pi *bvhPrimitiveInfo) bool {
+			return pi.centroid.Get(dim) < pMid
+		})
+		// lots of overlapping bounds can put everything on one side, fall back
+		// to equal counts then
+		if mid != 0 && mid != nPrimitives {
+			return mid
+		}
+	case SplitSAH:
+		if nPrimitives <= 2 {
+			break
+		}
+		return b.splitSAH(info, bounds, centroidBounds, dim)
+	}
+	mid := nPrimitives / 2
+	nthElement(info, mid, dim)
+	return mid
+}
+
+const nBuckets = 12
+
+// splitSAH bins the centroids into buckets along dim and splits at the bucket
+// boundary with the lowest estimated cost
+func (b *BVHAccel) splitSAH(info []bvhPrimitiveInfo, bounds, centroidBounds core.Bounds3, dim int) int {
+	nPrimitives := len(info)
+	var counts [nBuckets]int
+	var bucketBounds [nBuckets]core.Bounds3
+	for i := range bucketBounds {
+		bucketBounds[i] = core.NewEmptyBounds3()
+	}
+	bucketIndex := func(c core.Point3) int {
+		i := int(nBuckets * centroidBounds.Offset(c).Get(dim))
+		if i == nBuckets {
+			i = nBuckets - 1
+		}
+		return i
+	}
+	for i := range info {
+		bi := bucketIndex(info[i].centroid)
+		counts[bi]++
+		bucketBounds[bi] = core.UnionB3B3(bucketBounds[bi], info[i].bounds)
+	}
+
+	minCostSplitBucket, minCost := minCostSplit(&counts, &bucketBounds, bounds)
+
+	// Either split at the selected bucket or create a leaf
+	leafCost := float64(nPrimitives)
+	if nPrimitives <= b.maxPrimsInNode && minCost >= leafCost {
+		return -1
+	}
+	return partitionInfo(info, func(pi *bvhPrimitiveInfo) bool {
+		return bucketIndex(pi.centroid) <= minCostSplitBucket
+	})
+}
+
+// minCostSplit computes the cost of splitting after each bucket and returns the
+// cheapest, traversal is estimated to cost 1/8th of a primitive intersection
+func minCostSplit(counts *[nBuckets]int, bucketBounds *[nBuckets]core.Bounds3, bounds core.Bounds3) (int, float64) {
+	minCost := math.Inf(1)
+	minCostSplitBucket := 0
+	for i := 0; i < nBuckets-1; i++ {
+		b0, b1 := core.NewEmptyBounds3(), core.NewEmptyBounds3()
+		count0, count1 := 0, 0
+		for j := 0; j <= i; j++ {
+			b0 = core.UnionB3B3(b0, bucketBounds[j])
+			count0 += counts[j]
+		}
+		for j := i + 1; j < nBuckets; j++ {
+			b1 = core.UnionB3B3(b1, bucketBounds[j])
+			count1 += counts[j]
+		}
+		cost := 0.125 + (float64(count0)*b0.SurfaceArea()+float64(count1)*b1.SurfaceArea())/bounds.SurfaceArea()
+		if cost < minCost {
+			minCost = cost
+			minCostSplitBucket = i
+		}
+	}
+	return minCostSplitBucket, minCost
+}
+
+// partitionInfo moves every element satisfying pred in front of the ones that
+// don't, returns the index of the first element that doesn't
+func partitionInfo(info []bvhPrimitiveInfo, pred func(*bvhPrimitiveInfo) bool) int {
+	first := 0
+	for first < len(info) && pred(&info[first]) {
+		first++
+	}
+	for i := first + 1; i < len(info); i++ {
+		if pred(&info[i]) {
+			info[i], info[first] = info[first], info[i]
+			first++
+		}
+	}
+	return first
+}
+
+// nthElement partially sorts info by centroid along dim so that info[n] holds the
+// element a full sort would put there, with nothing greater before it and
+// nothing less after it
+func nthElement(info []bvhPrimitiveInfo, n, dim int) {
+	lo, hi := 0, len(info)
+	for hi-lo > 1 {
+		pivot := info[lo+(hi-lo)/2].centroid.Get(dim)
+		// three way partition so runs of equal centroids can't degrade it
+		lt, i, gt := lo, lo, hi
+		for i < gt {
+			c := info[i].centroid.Get(dim)
+			if c < pivot {
+				info[i], info[lt] = info[lt], info[i]
+				lt++
+				i++
+			} else if c > pivot {
+				gt--
+				info[i], info[gt] = info[gt], info[i]
+			} else {
+				i++
+			}
+		}
+		if n < lt {
+			hi = lt
+		} else if n >= gt {
+			lo = gt
+		} else {
+			return
+		}
+	}
+}
+
+func (b *BVHAccel) flattenBVHTree(node *bvhBuildNode, offset *int) int {
+	myOffset := *offset
+	*offset++
+	linearNode := &b.nodes[myOffset]
+	linearNode.bounds = node.bounds
+	if node.nPrimitives > 0 {
+		linearNode.offset = int32(node.firstPrimOffset)
+		linearNode.nPrimitives = uint16(node.nPrimitives)
+	} else {
+		linearNode.axis = uint8(node.splitAxis)
+		b.flattenBVHTree(node.children[0], offset)
+		linearNode.offset = int32(b.flattenBVHTree(node.children[1], offset))
+	}
+	return myOffset
+}
+
+func (b *BVHAccel) WorldBound() core.Bounds3 {
+	if len(b.nodes) == 0 {
+		return core.NewEmptyBounds3()
+	}
+	return b.nodes[0].bounds
+}
+
+func (b *BVHAccel) Intersect(r *core.Ray) (bool, core.SurfaceInteraction) {
+	var si core.SurfaceInteraction
+	hit := false
+	if len(b.nodes) == 0 {
+		return false, si
+	}
+	invDir, dirIsNeg := rayInverse(r.Dir)
+	// Follow ray through BVH nodes to find primitive intersections
+	toVisitOffset, currentNodeIndex := 0, 0
+	var nodesToVisit [64]int
+	for {
+		node := &b.nodes[currentNodeIndex]
+		if node.bounds.IntersectPInv(*r, invDir, dirIsNeg) {
+			if node.nPrimitives > 0 {
+				// Intersect ray with primitives in leaf, each hit shortens the ray
+				for i := 0; i < int(node.nPrimitives); i++ {
+					if ok, isect := b.primitives[int(node.offset)+i].Intersect(r); ok {
+						hit = true
+						si = isect
+					}
+				}
+				if toVisitOffset == 0 {
+					break
+				}
+				toVisitOffset--
+				currentNodeIndex = nodesToVisit[toVisitOffset]
+			} else {
+				// Visit the near child first
+				if dirIsNeg[node.axis] == 1 {
+					nodesToVisit[toVisitOffset] = currentNodeIndex + 1
+					currentNodeIndex = int(node.offset)
+				} else {
+					nodesToVisit[toVisitOffset] = int(node.offset)
+					currentNodeIndex = currentNodeIndex + 1
+				}
+				toVisitOffset++
+			}
+		} else {
+			if toVisitOffset == 0 {
+				break
+			}
+			toVisitOffset--
+			currentNodeIndex = nodesToVisit[toVisitOffset]
+		}
+	}
+	return hit, si
+}
+
+func (b *BVHAccel) IntersectP(r core.Ray) bool {
+	if len(b.nodes) == 0 {
+		return false
+	}
+	invDir, dirIsNeg := rayInverse(r.Dir)
+	toVisitOffset, currentNodeIndex := 0, 0
+	var nodesToVisit [64]int
+	for {
+		node := &b.nodes[currentNodeIndex]
+		if node.bounds.IntersectPInv(r, invDir, dirIsNeg) {
+			if node.nPrimitives > 0 {
+				// any hit will do
+				for i := 0; i < int(node.nPrimitives); i++ {
+					if b.primitives[int(node.offset)+i].IntersectP(r) {
+						return true
+					}
+				}
+				if toVisitOffset == 0 {
+					break
+				}
+				toVisitOffset--
+				currentNodeIndex = nodesToVisit[toVisitOffset]
+			} else {
+				if dirIsNeg[node.axis] == 1 {
+					nodesToVisit[toVisitOffset] = currentNodeIndex + 1
+					currentNodeIndex = int(node.offset)
+				} else {
+					nodesToVisit[toVisitOffset] = int(node.offset)
+					currentNodeIndex = currentNodeIndex + 1
+				}
+				toVisitOffset++
+			}
+		} else {
+			if toVisitOffset == 0 {
+				break
+			}
+			toVisitOffset--
+			currentNodeIndex = nodesToVisit[toVisitOffset]
+		}
+	}
+	return false
+}
+
+// aggregates have no material or area light, those come from the primitive hit
+func (b *BVHAccel) GetAreaLight() *core.AreaLight {
+	return nil
+}
+
+func (b *BVHAccel) GetMaterial() *core.Material {
+	return nil
+}
@@ -0,0 +1,195 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testPrimitive records its id as the last hit so tests can tell which
+// primitive an aggregate's Intersect ended on, every hit shortens the ray so the
+// last one is the closest
+type testPrimitive struct {
+	core.GeometricPrimitive
+	id      int
+	lastHit *int
+}
+
+func (p testPrimitive) Intersect(r *core.Ray) (bool, core.SurfaceInteraction) {
+	ok, si := p.GeometricPrimitive.Intersect(r)
+	if ok {
+		*p.lastHit = p.id
+	}
+	return ok, si
+}
+
+type testScene struct {
+	prims   []core.Primitive
+	lastHit *int
+}
+
+func newTestScene() *testScene {
+	return &testScene{lastHit: new(int)}
+}
+
+func (s *testScene) add(shapes ...core.ShapeInter) {
+	for _, shape := range shapes {
+		prim := core.NewGeometricPrimitive(shape, nil, nil, media.MediumInterface{})
+		s.prims = append(s.prims, testPrimitive{prim, len(s.prims), s.lastHit})
+	}
+}
+
+func (s *testScene) addSphere(center core.Vec3, radius float64) {
+	objToWorld := core.Translate(center)
+	worldToObj := objToWorld.Inverse()
+	s.add(core.NewSphere(&objToWorld, &worldToObj, false, radius, -radius, radius, 2*math.Pi))
+}
+
+func randomPoint(rng *rand.Rand, extent float64) core.Point3 {
+	return core.Point3{X: (rng.Float64()*2 - 1) * extent, Y: (rng.Float64()*2 - 1) * extent,
+		Z: (rng.Float64()*2 - 1) * extent}
+}
+
+// addRandom adds n spheres and n triangles in [-10, 10]^3
+func (s *testScene) addRandom(rng *rand.Rand, n int) {
+	for i := 0; i < n; i++ {
+		s.addSphere(randomPoint(rng, 10).ToVec(), 0.1+rng.Float64())
+	}
+	p := make([]core.Point3, 3*n)
+	indices := make([]int, 3*n)
+	for i := 0; i < n; i++ {
+		c := randomPoint(rng, 10)
+		for j := 0; j < 3; j++ {
+			p[3*i+j] = c.AddV(randomPoint(rng, 1.5).ToVec())
+			indices[3*i+j] = 3*i + j
+		}
+	}
+	id := core.NewTransform()
+	s.add(core.CreateTriangleMesh(&id, &id, false, indices, p, nil, nil, nil)...)
+}
+
+// randomRays go through the scene from all directions, some start inside it.
+// The rays along the axes have -0 components, which flip the slab order of a box
+func randomRays(rng *rand.Rand, s *testScene, n int) []core.Ray {
+	rays := make([]core.Ray, 0, n)
+	for i := 0; i < n; i++ {
+		o := randomPoint(rng, 15)
+		dir := randomPoint(rng, 10).SubtractP(o).Normalize()
+		rays = append(rays, core.NewRay(o, dir, math.Inf(1), 0, nil))
+	}
+	negZero := math.Copysign(0, -1)
+	for _, dir := range []core.Vec3{{X: negZero, Y: 0, Z: 1}, {X: 0, Y: negZero, Z: 1}, {X: negZero, Y: negZero, Z: -1},
+		{X: 1, Y: negZero, Z: negZero}, {X: negZero, Y: -1, Z: 0}} {
+		for i := 0; i < len(s.prims) && i < 50; i++ {
+			target := centroid(s.prims[i].WorldBound()).AddV(randomPoint(rng, 0.05).ToVec())
+			rays = append(rays, core.NewRay(target.AddV(dir.Multiply(-30)), dir, math.Inf(1), 0, nil))
+		}
+	}
+	return rays
+}
+
+// scanHit is what intersecting a ray with every primitive in turn finds
+type scanHit struct {
+	hit, hitP bool
+	primitive int
+	tMax      float64
+}
+
+func linearScan(s *testScene, rays []core.Ray) []scanHit {
+	hits := make([]scanHit, len(rays))
+	for i, r := range rays {
+		*s.lastHit = -1
+		for _, p := range s.prims {
+			if ok, _ := p.Intersect(&r); ok {
+				hits[i].hit = true
+			}
+			hits[i].hitP = hits[i].hitP || p.IntersectP(rays[i])
+		}
+		hits[i].primitive, hits[i].tMax = *s.lastHit, r.TMax()
+	}
+	return hits
+}
+
+// checkLinearScan compares the hits of agg with those of the linear scan
+func checkLinearScan(t *testing.T, agg core.Primitive, s *testScene, rays []core.Ray, want []scanHit) {
+	t.Helper()
+	for i, r := range rays {
+		*s.lastHit = -1
+		got, _ := agg.Intersect(&r)
+		if got != want[i].hit || r.TMax() != want[i].tMax || *s.lastHit != want[i].primitive {
+			t.Fatalf("ray %v: hit %v primitive %d at t %v, linear scan hit %v primitive %d at t %v",
+				rays[i], got, *s.lastHit, r.TMax(), want[i].hit, want[i].primitive, want[i].tMax)
+		}
+		if gotP := agg.IntersectP(rays[i]); gotP != want[i].hitP {
+			t.Fatalf("ray %v: IntersectP %v, linear scan %v", rays[i], gotP, want[i].hitP)
+		}
+	}
+}
+
+var testSplitMethods = []struct {
+	name   string
+	method SplitMethod
+}{{"sah", SplitSAH}, {"middle", SplitMiddle}, {"equal", SplitEqualCounts}, {"hlbvh", SplitHLBVH}}
+
+func TestBVHMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := newTestScene()
+	s.addRandom(rng, 500)
+	rays := randomRays(rng, s, 2000)
+	want := linearScan(s, rays)
+	for _, sm := range testSplitMethods {
+		for _, maxPrims := range []int{1, 4, 255} {
+			checkLinearScan(t, NewBVHAccel(s.prims, maxPrims, sm.method, 1), s, rays, want)
+		}
+	}
+}
+
+// a single primitive is a single leaf, rays along the axes with -0 components
+// used to miss it
+func TestBVHSinglePrimitive(t *testing.T) {
+	s := newTestScene()
+	s.addSphere(core.Vec3{}, 1)
+	rays := randomRays(rand.New(rand.NewSource(2)), s, 100)
+	want := linearScan(s, rays)
+	for _, sm := range testSplitMethods {
+		checkLinearScan(t, NewBVHAccel(s.prims, 4, sm.method, 1), s, rays, want)
+	}
+}
+
+func TestBVHEmpty(t *testing.T) {
+	b := NewBVHAccel(nil, 4, SplitSAH, 1)
+	r := core.NewRay(core.Point3{}, core.Vec3{Z: 1}, math.Inf(1), 0, nil)
+	if ok, _ := b.Intersect(&r); ok || b.IntersectP(r) {
+		t.Errorf("empty BVH was hit")
+	}
+}
+
+// the tree has to be the same whatever the number of goroutines building it,
+// enough primitives that subtrees are built in parallel
+func TestBVHParallelBuildIsDeterministic(t *testing.T) {
+	s := newTestScene()
+	s.addRandom(rand.New(rand.NewSource(3)), 3*parallelBuildThreshold)
+	for _, sm := range testSplitMethods {
+		serial := NewBVHAccel(s.prims, 4, sm.method, 1)
+		for _, nThreads := range []int{2, 8} {
+			parallel := NewBVHAccel(s.prims, 4, sm.method, nThreads)
+			if len(parallel.nodes) != len(serial.nodes) {
+				t.Fatalf("%s: %d nodes with %d threads, %d with one", sm.name, len(parallel.nodes), nThreads,
+					len(serial.nodes))
+			}
+			for i := range serial.nodes {
+				if parallel.nodes[i] != serial.nodes[i] {
+					t.Fatalf("%s: node %d is %+v with %d threads, %+v with one", sm.name, i, parallel.nodes[i],
+						nThreads, serial.nodes[i])
+				}
+			}
+			for i := range serial.primitives {
+				if p, q := parallel.primitives[i].(testPrimitive).id, serial.primitives[i].(testPrimitive).id; p != q {
+					t.Fatalf("%s: primitive %d is %d with %d threads, %d with one", sm.name, i, p, nThreads, q)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"sync/atomic"
+)
+
+// number of bits used per axis by the Morton codes
+const mortonBits = 10
+
+type mortonPrimitive struct {
+	primitiveIndex int
+	mortonCode     uint32
+}
+
+// spreads the low 10 bits of x so there are two zero bits between each of them
+func leftShift3(x uint32) uint32 {
+	if x == 1<<mortonBits {
+		x--
+	}
+	x = (x | (x << 16)) & 0x030000ff
+	x = (x | (x << 8)) & 0x0300f00f
+	x = (x | (x << 4)) & 0x030c30c3
+	x = (x | (x << 2)) & 0x09249249
+	return x
+}
+
+// encodeMorton3 interleaves the bits of the coordinates of v, which must be in
+// [0, 2^10]
+func encodeMorton3(v core.Vec3) uint32 {
+	return (leftShift3(uint32(v.Z)) << 2) | (leftShift3(uint32(v.Y)) << 1) | leftShift3(uint32(v.X))
+}
+
+// radixSort sorts by Morton code, it's stable so primitives with the same code
+// keep their input order
+func radixSort(v []mortonPrimitive) {
+	const bitsPerPass = 6
+	const nBits = 3 * mortonBits
+	const nPasses = nBits / bitsPerPass
+	const nBuckets = 1 << bitsPerPass
+	const bitMask = nBuckets - 1
+	tmp := make([]mortonPrimitive, len(v))
+	in, out := v, tmp
+	for pass := 0; pass < nPasses; pass++ {
+		lowBit := uint(pass * bitsPerPass)
+
+		// Count the values in each bucket then turn the counts into offsets
+		var bucketCount [nBuckets]int
+		for _, mp := range in {
+			bucketCount[(mp.mortonCode>>lowBit)&bitMask]++
+		}
+		var outIndex [nBuckets]int
+		for i := 1; i < nBuckets; i++ {
+			outIndex[i] = outIndex[i-1] + bucketCount[i-1]
+		}
+		for _, mp := range in {
+			bucket := (mp.mortonCode >> lowBit) & bitMask
+			out[outIndex[bucket]] = mp
+			outIndex[bucket]++
+		}
+		in, out = out, in
+	}
+	if nPasses%2 == 1 {
+		copy(v, in)
+	}
+}
+
+// a treelet holds the primitives that share the top bits of their Morton code
+type lbvhTreelet struct {
+	start, nPrimitives int
+	root               *bvhBuildNode
+}
+
+/*
+hlbvhBuild sorts the primitives along a Morton curve and cuts the curve into
+treelets of primitives that fall in the same cell of a coarse grid. The treelets
+are built in parallel by splitting on the Morton code bits, then SAH is used to
+join them. info is put in Morton order and leaves refer to positions in it, the
+same way recursiveBuild does, so the tree doesn't depend on the thread count.
+*/
+func (b *BVHAccel) hlbvhBuild(w *workers, info []bvhPrimitiveInfo, totalNodes *int64) *bvhBuildNode {
+	// Compute bounding box of all primitive centroids
+	bounds := core.NewEmptyBounds3()
+	for i := range info {
+		bounds = core.UnionB3P(bounds, info[i].centroid)
+	}
+
+	// Compute Morton indices of primitives
+	mortonPrims := make([]mortonPrimitive, len(info))
+	w.parallelFor(len(info), func(i int) {
+		const mortonScale = 1 << mortonBits
+		centroidOffset := bounds.Offset(info[i].centroid)
+		mortonPrims[i] = mortonPrimitive{i, encodeMorton3(centroidOffset.Multiply(mortonScale))}
+	})
+	radixSort(mortonPrims)
+	sorted := make([]bvhPrimitiveInfo, len(info))
+	for i, mp := range mortonPrims {
+		sorted[i] = info[mp.primitiveIndex]
+	}
+	copy(info, sorted)
+
+	// Find intervals of primitives for each treelet, they share the top 12 bits
+	var treelets []lbvhTreelet
+	const mask = 0x3ffc0000
+	for start, end := 0, 1; end <= len(mortonPrims); end++ {
+		if end == len(mortonPrims) || mortonPrims[start].mortonCode&mask != mortonPrims[end].mortonCode&mask {
+			treelets = append(treelets, lbvhTreelet{start: start, nPrimitives: end - start})
+			start = end
+		}
+	}
+
+	// Create LBVHs for treelets in parallel
+	const firstBitIndex = 3*mortonBits - 1 - 12
+	w.parallelFor(len(treelets), func(i int) {
+		tr := &treelets[i]
+		tr.root = b.emitLBVH(info[tr.start:tr.start+tr.nPrimitives], mortonPrims[tr.start:tr.start+tr.nPrimitives],
+			tr.start, firstBitIndex, totalNodes)
+	})
+
+	// Create and return SAH BVH from LBVH treelets
+	roots := make([]*bvhBuildNode, len(treelets))
+	for i := range treelets {
+		roots[i] = treelets[i].root
+	}
+	return b.buildUpperSAH(roots, totalNodes)
+}
+
+// emitLBVH splits the primitives at the first Morton code bit, starting from
+// bitIndex, where they differ. first is the position of info in the whole array
+func (b *BVHAccel) emitLBVH(info []bvhPrimitiveInfo, mortonPrims []mortonPrimitive, first, bitIndex int,
+	totalNodes *int64) *bvhBuildNode {
+	nPrimitives := len(info)
+	if bitIndex == -1 || nPrimitives < b.maxPrimsInNode {
+		// Create and return leaf node of LBVH treelet
+		atomic.AddInt64(totalNodes, 1)
+		bounds := core.NewEmptyBounds3()
+		for i := range info {
+			bounds = core.UnionB3B3(bounds, info[i].bounds)
+		}
+		return newLeafNode(first, nPrimitives, bounds)
+	}
+
+	mask := uint32(1) << uint(bitIndex)
+	// Advance to next subtree level if there's no split for this bit
+	if mortonPrims[0].mortonCode&mask == mortonPrims[nPrimitives-1].mortonCode&mask {
+		return b.emitLBVH(info, mortonPrims, first, bitIndex-1, totalNodes)
+	}
+
+	// Find the split, the codes are sorted so it's the first one with the bit set
+	searchStart, searchEnd := 0, nPrimitives-1
+	for searchStart+1 != searchEnd {
+		mid := (searchStart + searchEnd) / 2
+		if mortonPrims[searchStart].mortonCode&mask == mortonPrims[mid].mortonCode&mask {
+			searchStart = mid
+		} else {
+			searchEnd = mid
+		}
+	}
+	splitOffset := searchEnd
+
+	atomic.AddInt64(totalNodes, 1)
+	c0 := b.emitLBVH(info[:splitOffset], mortonPrims[:splitOffset], first, bitIndex-1, totalNodes)
+	c1 := b.emitLBVH(info[splitOffset:], mortonPrims[splitOffset:], first+splitOffset, bitIndex-1, totalNodes)
+	return newInteriorNode(bitIndex%3, c0, c1)
+}
+
+// buildUpperSAH joins the treelet roots with a SAH build over their bounds
+func (b *BVHAccel) buildUpperSAH(roots []*bvhBuildNode, totalNodes *int64) *bvhBuildNode {
+	nNodes := len(roots)
+	if nNodes == 1 {
+		return roots[0]
+	}
+	atomic.AddInt64(totalNodes, 1)
+
+	// Compute bounds of all nodes and their centroids, choose split dimension
+	bounds := core.NewEmptyBounds3()
+	centroidBounds := core.NewEmptyBounds3()
+	for _, n := range roots {
+		bounds = core.UnionB3B3(bounds, n.bounds)
+		centroidBounds = core.UnionB3P(centroidBounds, centroid(n.bounds))
+	}
+	dim := centroidBounds.MaxExtent()
+
+	// Bucket the nodes and find the cheapest split like splitSAH does
+	var counts [nBuckets]int
+	var bucketBounds [nBuckets]core.Bounds3
+	for i := range bucketBounds {
+		bucketBounds[i] = core.NewEmptyBounds3()
+	}
+	bucketIndex := func(n *bvhBuildNode) int {
+		i := int(nBuckets * centroidBounds.Offset(centroid(n.bounds)).Get(dim))
+		if i == nBuckets {
+			i = nBuckets - 1
+		}
+		return i
+	}
+	for _, n := range roots {
+		bi := bucketIndex(n)
+		counts[bi]++
+		bucketBounds[bi] = core.UnionB3B3(bucketBounds[bi], n.bounds)
+	}
+	minCostSplitBucket, _ := minCostSplit(&counts, &bucketBounds, bounds)
+
+	// Split nodes, treelets whose centroids line up can all land in one bucket
+	// and then they are just halved
+	mid := 0
+	for i, n := range roots {
+		if bucketIndex(n) <= minCostSplitBucket {
+			roots[i], roots[mid] = roots[mid], roots[i]
+			mid++
+		}
+	}
+	if mid == 0 || mid == nNodes {
+		mid = nNodes / 2
+	}
+	return newInteriorNode(dim, b.buildUpperSAH(roots[:mid], totalNodes), b.buildUpperSAH(roots[mid:], totalNodes))
+}
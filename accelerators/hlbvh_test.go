@@ -0,0 +1,72 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestEncodeMorton3(t *testing.T) {
+	tests := []struct {
+		v    core.Vec3
+		code uint32
+	}{
+		{core.Vec3{}, 0},
+		{core.Vec3{X: 1}, 1},
+		{core.Vec3{Y: 1}, 2},
+		{core.Vec3{Z: 1}, 4},
+		{core.Vec3{X: 3, Y: 1}, 0b1011},
+		{core.Vec3{X: 1023}, 0x09249249},
+		{core.Vec3{X: 1023, Y: 1023, Z: 1023}, 1<<30 - 1},
+		// the top of the range is clamped into the last cell
+		{core.Vec3{X: 1024, Y: 1024, Z: 1024}, 1<<30 - 1},
+		// fractions are truncated
+		{core.Vec3{X: 5.9, Y: 0.5, Z: 2.2}, encodeMorton3(core.Vec3{X: 5, Z: 2})},
+	}
+	for _, test := range tests {
+		if code := encodeMorton3(test.v); code != test.code {
+			t.Errorf("encodeMorton3(%v) = %#x, expected %#x", test.v, code, test.code)
+		}
+	}
+}
+
+func TestRadixSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 100, 5000} {
+		v := make([]mortonPrimitive, n)
+		for i := range v {
+			// few distinct codes so stability matters
+			v[i] = mortonPrimitive{i, uint32(rng.Intn(50)) << uint(rng.Intn(25))}
+		}
+		want := append([]mortonPrimitive(nil), v...)
+		sort.SliceStable(want, func(i, j int) bool { return want[i].mortonCode < want[j].mortonCode })
+		radixSort(v)
+		for i := range v {
+			if v[i] != want[i] {
+				t.Fatalf("n = %d: element %d is %v, expected %v", n, i, v[i], want[i])
+			}
+		}
+	}
+}
+
+// with every centroid in the same place all Morton codes are equal and the
+// treelets can't be split on them
+func TestHLBVHEqualCentroids(t *testing.T) {
+	s := newTestScene()
+	for i := 0; i < 300; i++ {
+		s.addSphere(core.Vec3{X: 1, Y: 2, Z: 3}, 0.01+float64(i)*0.05)
+	}
+	rng := rand.New(rand.NewSource(4))
+	rays := randomRays(rng, s, 500)
+	// rays starting between the shells hit the next one out
+	for i := 0; i < 200; i++ {
+		o := core.Point3{X: 1, Y: 2, Z: 3}.AddV(randomPoint(rng, 8).ToVec())
+		rays = append(rays, core.NewRay(o, randomPoint(rng, 1).ToVec().Normalize(), math.Inf(1), 0, nil))
+	}
+	want := linearScan(s, rays)
+	for _, maxPrims := range []int{1, 4, 255} {
+		checkLinearScan(t, NewBVHAccel(s.prims, maxPrims, SplitHLBVH, 1), s, rays, want)
+	}
+}
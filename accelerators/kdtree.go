@@ -0,0 +1,353 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// kdAccelNode is either an interior node splitting space with an axis aligned
+// plane or a leaf holding primitives. The below child of an interior node is the
+// node right after it, only the above child is stored
+type kdAccelNode struct {
+	// position of the plane for interior nodes
+	split float64
+	// for leaves, the primitive if there is exactly one otherwise the offset of
+	// the leaf's primitive indices
+	primitive int32
+	// low 2 bits hold the split axis or 3 for leaves, the rest is the number of
+	// primitives for leaves and the above child for interior nodes
+	flags uint32
+}
+
+func (n *kdAccelNode) initLeaf(primNums []int, primitiveIndices *[]int32) {
+	n.flags = 3 | uint32(len(primNums))<<2
+	switch len(primNums) {
+	case 0:
+		n.primitive = 0
+	case 1:
+		n.primitive = int32(primNums[0])
+	default:
+		n.primitive = int32(len(*primitiveIndices))
+		for _, pn := range primNums {
+			*primitiveIndices = append(*primitiveIndices, int32(pn))
+		}
+	}
+}
+
+func (n *kdAccelNode) initInterior(axis, aboveChild int, s float64) {
+	n.split = s
+	n.flags = uint32(axis) | uint32(aboveChild)<<2
+}
+
+func (n *kdAccelNode) splitPos() float64 { return n.split }
+func (n *kdAccelNode) nPrimitives() int  { return int(n.flags >> 2) }
+func (n *kdAccelNode) splitAxis() int    { return int(n.flags & 3) }
+func (n *kdAccelNode) isLeaf() bool      { return n.flags&3 == 3 }
+func (n *kdAccelNode) aboveChild() int   { return int(n.flags >> 2) }
+
+type edgeType int
+
+const (
+	edgeStart edgeType = iota
+	edgeEnd
+)
+
+// boundEdge is where a primitive's bounds start or end along an axis
+type boundEdge struct {
+	t       float64
+	primNum int
+	typ     edgeType
+}
+
+// KdTreeAccel recursively splits space in two with axis aligned planes chosen
+// with the surface area heuristic
+type KdTreeAccel struct {
+	isectCost, traversalCost, maxPrims int
+	emptyBonus                         float64
+	primitives                         []core.Primitive
+	primitiveIndices                   []int32
+	nodes                              []kdAccelNode
+	bounds                             core.Bounds3
+}
+
+/*
+NewKdTreeAccel builds the tree over prims. isectCost and traversalCost are the
+estimated costs of a primitive intersection and of a node traversal, emptyBonus
+in [0, 1] makes splits that leave one side empty cheaper, maxPrims is the number
+of primitives under which no split is tried and maxDepth limits the depth of the
+tree, a value <= 0 picks one from the number of primitives.
+*/
+func NewKdTreeAccel(prims []core.Primitive, isectCost, traversalCost int, emptyBonus float64,
+	maxPrims, maxDepth int) *KdTreeAccel {
+	k := &KdTreeAccel{
+		isectCost:     isectCost,
+		traversalCost: traversalCost,
+		maxPrims:      maxPrims,
+		emptyBonus:    emptyBonus,
+		primitives:    prims,
+		bounds:        core.NewEmptyBounds3(),
+	}
+	if len(prims) == 0 {
+		return k
+	}
+	if maxDepth <= 0 {
+		maxDepth = int(math.Round(8 + 1.3*float64(bits.Len64(uint64(len(prims)))-1)))
+	}
+
+	// Compute bounds for kd-tree construction
+	primBounds := make([]core.Bounds3, len(prims))
+	for i, p := range prims {
+		primBounds[i] = p.WorldBound()
+		k.bounds = core.UnionB3B3(k.bounds, primBounds[i])
+	}
+
+	// Start recursive construction of kd-tree with every primitive
+	var edges [3][]boundEdge
+	for i := range edges {
+		edges[i] = make([]boundEdge, 2*len(prims))
+	}
+	primNums := make([]int, len(prims))
+	for i := range primNums {
+		primNums[i] = i
+	}
+	k.buildTree(k.bounds, primBounds, primNums, maxDepth, &edges, 0)
+	return k
+}
+
+func (k *KdTreeAccel) buildTree(nodeBounds core.Bounds3, allPrimBounds []core.Bounds3, primNums []int,
+	depth int, edges *[3][]boundEdge, badRefines int) {
+	nodeNum := len(k.nodes)
+	k.nodes = append(k.nodes, kdAccelNode{})
+	nPrimitives := len(primNums)
+
+	// Initialize leaf node if termination criteria met
+	if nPrimitives <= k.maxPrims || depth == 0 {
+		k.nodes[nodeNum].initLeaf(primNums, &k.primitiveIndices)
+		return
+	}
+
+	// Choose split axis position for interior node
+	bestAxis, bestOffset := -1, -1
+	bestCost := math.Inf(1)
+	oldCost := float64(k.isectCost * nPrimitives)
+	invTotalSA := 1 / nodeBounds.SurfaceArea()
+	pMin, pMax := nodeBounds.Get(0), nodeBounds.Get(1)
+	d := pMax.SubtractP(pMin)
+	axis := nodeBounds.MaxExtent()
+	for retries := 0; retries < 3 && bestAxis == -1; retries++ {
+		// Initialize edges for axis, ties are broken by primitive so the
+		// sort can't change the tree
+		axisEdges := edges[axis][:2*nPrimitives]
+		for i, pn := range primNums {
+			b := allPrimBounds[pn]
+			axisEdges[2*i] = boundEdge{b.Get(0).Get(axis), pn, edgeStart}
+			axisEdges[2*i+1] = boundEdge{b.Get(1).Get(axis), pn, edgeEnd}
+		}
+		sort.Slice(axisEdges, func(i, j int) bool {
+			e0, e1 := &axisEdges[i], &axisEdges[j]
+			if e0.t != e1.t {
+				return e0.t < e1.t
+			}
+			if e0.typ != e1.typ {
+				return e0.typ < e1.typ
+			}
+			return e0.primNum < e1.primNum
+		})
+
+		// Compute cost of all splits for axis to find best
+		nBelow, nAbove := 0, nPrimitives
+		for i := range axisEdges {
+			if axisEdges[i].typ == edgeEnd {
+				nAbove--
+			}
+			edgeT := axisEdges[i].t
+			if edgeT > pMin.Get(axis) && edgeT < pMax.Get(axis) {
+				// Compute cost for split at ith edge
+				otherAxis0, otherAxis1 := (axis+1)%3, (axis+2)%3
+				faceSA := d.Get(otherAxis0) * d.Get(otherAxis1)
+				perimeter := d.Get(otherAxis0) + d.Get(otherAxis1)
+				belowSA := 2 * (faceSA + (edgeT-pMin.Get(axis))*perimeter)
+				aboveSA := 2 * (faceSA + (pMax.Get(axis)-edgeT)*perimeter)
+				pBelow, pAbove := belowSA*invTotalSA, aboveSA*invTotalSA
+				eb := 0.0
+				if nAbove == 0 || nBelow == 0 {
+					eb = k.emptyBonus
+				}
+				cost := float64(k.traversalCost) +
+					float64(k.isectCost)*(1-eb)*(pBelow*float64(nBelow)+pAbove*float64(nAbove))
+				if cost < bestCost {
+					bestCost, bestAxis, bestOffset = cost, axis, i
+				}
+			}
+			if axisEdges[i].typ == edgeStart {
+				nBelow++
+			}
+		}
+		// Try the other axes if no good split was found
+		axis = (axis + 1) % 3
+	}
+
+	// Create leaf if no good splits were found
+	if bestCost > oldCost {
+		badRefines++
+	}
+	if (bestCost > 4*oldCost && nPrimitives < 16) || bestAxis == -1 || badRefines == 3 {
+		k.nodes[nodeNum].initLeaf(primNums, &k.primitiveIndices)
+		return
+	}
+
+	// Classify primitives with respect to split
+	bestEdges := edges[bestAxis][:2*nPrimitives]
+	var prims0, prims1 []int
+	for i := 0; i < bestOffset; i++ {
+		if bestEdges[i].typ == edgeStart {
+			prims0 = append(prims0, bestEdges[i].primNum)
+		}
+	}
+	for i := bestOffset + 1; i < len(bestEdges); i++ {
+		if bestEdges[i].typ == edgeEnd {
+			prims1 = append(prims1, bestEdges[i].primNum)
+		}
+	}
+
+	// Recursively initialize children nodes
+	tSplit := bestEdges[bestOffset].t
+	bounds0 := core.NewBounds3(pMin, setComponent(pMax, bestAxis, tSplit))
+	bounds1 := core.NewBounds3(setComponent(pMin, bestAxis, tSplit), pMax)
+	k.buildTree(bounds0, allPrimBounds, prims0, depth-1, edges, badRefines)
+	aboveChild := len(k.nodes)
+	k.nodes[nodeNum].initInterior(bestAxis, aboveChild, tSplit)
+	k.buildTree(bounds1, allPrimBounds, prims1, depth-1, edges, badRefines)
+}
+
+// copy of p with coordinate axis set to v
+func setComponent(p core.Point3, axis int, v float64) core.Point3 {
+	switch axis {
+	case 0:
+		p.X = v
+	case 1:
+		p.Y = v
+	default:
+		p.Z = v
+	}
+	return p
+}
+
+func (k *KdTreeAccel) WorldBound() core.Bounds3 {
+	return k.bounds
+}
+
+// kdToDo is a node still to be visited and the parametric range of the ray in it
+type kdToDo struct {
+	node       int
+	tMin, tMax float64
+}
+
+// walk visits the leaves the ray goes through from front to back, it stops when
+// leaf returns true or the ray's range ends before the next node
+func (k *KdTreeAccel) walk(r *core.Ray, leaf func(node *kdAccelNode) bool) {
+	if len(k.nodes) == 0 {
+		return
+	}
+	// Compute initial parametric range of ray inside kd-tree extent
+	ok, tMin, tMax := k.bounds.IntersectP(*r)
+	if !ok {
+		return
+	}
+
+	invDir, _ := rayInverse(r.Dir)
+	todo := make([]kdToDo, 0, 64)
+	nodeNum := 0
+	for {
+		// Bail out if we found a hit closer than the current node
+		if r.TMax() < tMin {
+			return
+		}
+		node := &k.nodes[nodeNum]
+		if !node.isLeaf() {
+			// Compute parametric distance along ray to split plane
+			axis := node.splitAxis()
+			orig := r.Orig.Get(axis)
+			tPlane := (node.splitPos() - orig) * invDir.Get(axis)
+
+			// Get node children pointers for ray
+			firstChild, secondChild := nodeNum+1, node.aboveChild()
+			belowFirst := orig < node.splitPos() || (orig == node.splitPos() && r.Dir.Get(axis) <= 0)
+			if !belowFirst {
+				firstChild, secondChild = secondChild, firstChild
+			}
+
+			// Advance to next child node, possibly enqueue other child
+			if tPlane > tMax || tPlane <= 0 {
+				nodeNum = firstChild
+			} else if tPlane < tMin {
+				nodeNum = secondChild
+			} else {
+				todo = append(todo, kdToDo{secondChild, tPlane, tMax})
+				nodeNum = firstChild
+				tMax = tPlane
+			}
+			continue
+		}
+
+		if leaf(node) {
+			return
+		}
+		// Grab next node to process from todo list
+		if len(todo) == 0 {
+			return
+		}
+		next := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		nodeNum, tMin, tMax = next.node, next.tMin, next.tMax
+	}
+}
+
+// leafPrimitive returns the ith primitive of a leaf
+func (k *KdTreeAccel) leafPrimitive(node *kdAccelNode, i int) core.Primitive {
+	if node.nPrimitives() == 1 {
+		return k.primitives[node.primitive]
+	}
+	return k.primitives[k.primitiveIndices[int(node.primitive)+i]]
+}
+
+func (k *KdTreeAccel) Intersect(r *core.Ray) (bool, core.SurfaceInteraction) {
+	var si core.SurfaceInteraction
+	hit := false
+	k.walk(r, func(node *kdAccelNode) bool {
+		// Check for intersections inside leaf node, each hit shortens the ray
+		for i := 0; i < node.nPrimitives(); i++ {
+			if ok, isect := k.leafPrimitive(node, i).Intersect(r); ok {
+				hit = true
+				si = isect
+			}
+		}
+		return false
+	})
+	return hit, si
+}
+
+func (k *KdTreeAccel) IntersectP(r core.Ray) bool {
+	hit := false
+	k.walk(&r, func(node *kdAccelNode) bool {
+		for i := 0; i < node.nPrimitives(); i++ {
+			if k.leafPrimitive(node, i).IntersectP(r) {
+				hit = true
+				return true
+			}
+		}
+		return false
+	})
+	return hit
+}
+
+// aggregates have no material or area light, those come from the primitive hit
+func (k *KdTreeAccel) GetAreaLight() *core.AreaLight {
+	return nil
+}
+
+func (k *KdTreeAccel) GetMaterial() *core.Material {
+	return nil
+}
@@ -0,0 +1,84 @@
+package accelerators
+
+import (
+	"Anvil/core"
+	"math/rand"
+	"testing"
+)
+
+// addWall adds a grid of n x n quads in the plane where axis is c, over
+// [-5, 5] along the other two axes
+func (s *testScene) addWall(axis int, c float64, n int) {
+	var p []core.Point3
+	var indices []int
+	at := func(u, v float64) core.Point3 {
+		coords := [3]float64{}
+		coords[axis], coords[(axis+1)%3], coords[(axis+2)%3] = c, u, v
+		return core.Point3{X: coords[0], Y: coords[1], Z: coords[2]}
+	}
+	step := 10 / float64(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			u, v := -5+float64(i)*step, -5+float64(j)*step
+			first := len(p)
+			p = append(p, at(u, v), at(u+step, v), at(u+step, v+step), at(u, v+step))
+			indices = append(indices, first, first+1, first+2, first, first+2, first+3)
+		}
+	}
+	id := core.NewTransform()
+	s.add(core.CreateTriangleMesh(&id, &id, false, indices, p, nil, nil, nil)...)
+}
+
+var testKdTreeSettings = []struct {
+	emptyBonus         float64
+	maxPrims, maxDepth int
+}{
+	{0.5, 1, -1},
+	{0, 1, -1},
+	{1, 1, -1},
+	{0.5, 4, -1},
+	{0.5, 1, 1},
+	{0.5, 1, 3},
+	{0.5, 16, 30},
+}
+
+func TestKdTreeMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	s := newTestScene()
+	s.addRandom(rng, 300)
+	rays := randomRays(rng, s, 1000)
+	want := linearScan(s, rays)
+	for _, c := range testKdTreeSettings {
+		checkLinearScan(t, NewKdTreeAccel(s.prims, 80, 1, c.emptyBonus, c.maxPrims, c.maxDepth), s, rays, want)
+	}
+}
+
+// the primitives of axis aligned walls have flat bounds that lie on the split
+// planes, they have to end up on the side the rays reach them from
+func TestKdTreeAxisAlignedWalls(t *testing.T) {
+	s := newTestScene()
+	s.addWall(0, -5, 8)
+	s.addWall(0, 0, 8)
+	s.addWall(1, 5, 8)
+	s.addWall(2, 0, 16)
+	s.addWall(2, 2.5, 4)
+	rng := rand.New(rand.NewSource(6))
+	rays := randomRays(rng, s, 2000)
+	want := linearScan(s, rays)
+	for _, c := range testKdTreeSettings {
+		checkLinearScan(t, NewKdTreeAccel(s.prims, 80, 1, c.emptyBonus, c.maxPrims, c.maxDepth), s, rays, want)
+	}
+}
+
+func TestKdTreeSinglePrimitive(t *testing.T) {
+	s := newTestScene()
+	s.addSphere(core.Vec3{X: 1}, 1)
+	rays := randomRays(rand.New(rand.NewSource(7)), s, 100)
+	want := linearScan(s, rays)
+	checkLinearScan(t, NewKdTreeAccel(s.prims, 80, 1, 0.5, 1, -1), s, rays, want)
+
+	k := NewKdTreeAccel(nil, 80, 1, 0.5, 1, -1)
+	if ok, _ := k.Intersect(&rays[0]); ok || k.IntersectP(rays[0]) {
+		t.Errorf("empty kd-tree was hit")
+	}
+}
@@ -0,0 +1,120 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+)
+
+// CameraSample is everything a camera needs to generate a ray: the point on the
+// film in raster coordinates, the point on the lens in [0, 1)^2 and the time in
+// [0, 1) which the camera's shutter maps to the time of the ray
+type CameraSample struct {
+	PFilm, PLens core.Point2
+	Time         float64
+}
+
+/*
+Camera generates the world space rays that sample the image. The returned
+weight is how much the radiance along the ray contributes to the film, simple
+cameras always return 1. GenerateRayDifferential also fills in the rays of the
+neighbouring pixels in x and y so textures can be filtered over the footprint of
+a pixel.
+*/
+type Camera interface {
+	GenerateRay(sample CameraSample) (float64, core.Ray)
+	GenerateRayDifferential(sample CameraSample) (float64, core.RayDifferential)
+}
+
+/*
+projectiveCamera holds the transforms shared by the cameras that project the
+scene with a 4x4 matrix. Screen space is where the projection lands, the screen
+window is the part of it that the film covers. Raster space has (0, 0) at the
+upper left corner of the film and one unit per pixel.
+*/
+type projectiveCamera struct {
+	cameraToWorld  *core.AnimatedTransform
+	shutter        Shutter
+	fullResolution core.Point2
+	cameraToScreen core.Transform
+	rasterToCamera core.Transform
+	screenToRaster core.Transform
+	rasterToScreen core.Transform
+	lensRadius     float64
+	focalDistance  float64
+	medium         *media.Medium
+}
+
+func newProjectiveCamera(cameraToWorld *core.AnimatedTransform, shutter Shutter, cameraToScreen core.Transform,
+	screenWindow core.Bounds2, fullResolution core.Point2, lensRadius, focalDistance float64,
+	medium *media.Medium) projectiveCamera {
+	// Compute projective camera screen transformations
+	pMin, pMax := screenWindow.Get(0), screenWindow.Get(1)
+	screenToRaster := core.ConcatTransforms(
+		core.ConcatTransforms(core.Scale(fullResolution.X, fullResolution.Y, 1),
+			core.Scale(1/(pMax.X-pMin.X), 1/(pMin.Y-pMax.Y), 1)),
+		core.Translate(core.Vec3{X: -pMin.X, Y: -pMax.Y}))
+	rasterToScreen := screenToRaster.Inverse()
+	return projectiveCamera{
+		cameraToWorld:  cameraToWorld,
+		shutter:        shutter,
+		fullResolution: fullResolution,
+		cameraToScreen: cameraToScreen,
+		rasterToCamera: core.ConcatTransforms(cameraToScreen.Inverse(), rasterToScreen),
+		screenToRaster: screenToRaster,
+		rasterToScreen: rasterToScreen,
+		lensRadius:     lensRadius,
+		focalDistance:  focalDistance,
+		medium:         medium,
+	}
+}
+
+// time is the time of the ray for sample
+func (c *projectiveCamera) time(sample CameraSample) float64 {
+	return c.shutter.Time(sample.Time, sample.PFilm.Y/c.fullResolution.Y)
+}
+
+// thinLens turns the pinhole ray from o along d into the ray through the point on
+// the lens that u maps to, both rays meet on the plane of focus
+func (c *projectiveCamera) thinLens(o core.Point3, d core.Vec3, u core.Point2) (core.Point3, core.Vec3) {
+	if c.lensRadius <= 0 {
+		return o, d
+	}
+	// Sample point on lens
+	pLens := core.ConcentricSampleDisk(u).Multiply(c.lensRadius)
+
+	// Compute point on plane of focus
+	ft := c.focalDistance / d.Z
+	pFocus := o.AddV(d.Multiply(ft))
+
+	// Update ray for effect of lens
+	oLens := o.AddV(core.Vec3{X: pLens.X, Y: pLens.Y})
+	return oLens, pFocus.SubtractP(oLens).Normalize()
+}
+
+// generateRayDifferential is GenerateRayDifferential for cameras that can only
+// generate single rays, the differentials are the rays one pixel over
+func generateRayDifferential(camera Camera, sample CameraSample) (float64, core.RayDifferential) {
+	wt, r := camera.GenerateRay(sample)
+	if wt == 0 {
+		return 0, core.RayDifferential{}
+	}
+	rd := core.NewRayDifferential(&r)
+
+	// Find camera ray after shifting one pixel in the x and y directions
+	sShift := sample
+	sShift.PFilm.X++
+	wtx, rx := camera.GenerateRay(sShift)
+	if wtx == 0 {
+		return 0, core.RayDifferential{}
+	}
+	sShift.PFilm.X--
+	sShift.PFilm.Y++
+	wty, ry := camera.GenerateRay(sShift)
+	if wty == 0 {
+		return 0, core.RayDifferential{}
+	}
+	rd.RxOrigin, rd.RxDir = rx.Orig, rx.Dir
+	rd.RyOrigin, rd.RyDir = ry.Orig, ry.Dir
+	rd.HasDifferentials = true
+	return wt, rd
+}
@@ -0,0 +1,36 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"math"
+)
+
+// EnvironmentCamera sees in every direction from a single point and stores them
+// as a lat-long image: x is the angle phi around camera space y, y is the angle
+// theta from +y down to -y
+type EnvironmentCamera struct {
+	cameraToWorld  *core.AnimatedTransform
+	shutter        Shutter
+	fullResolution core.Point2
+	medium         *media.Medium
+}
+
+func NewEnvironmentCamera(cameraToWorld *core.AnimatedTransform, shutter Shutter, fullResolution core.Point2,
+	medium *media.Medium) *EnvironmentCamera {
+	return &EnvironmentCamera{cameraToWorld, shutter, fullResolution, medium}
+}
+
+func (self *EnvironmentCamera) GenerateRay(sample CameraSample) (float64, core.Ray) {
+	// Compute environment camera ray direction
+	theta := math.Pi * sample.PFilm.Y / self.fullResolution.Y
+	phi := 2 * math.Pi * sample.PFilm.X / self.fullResolution.X
+	dir := core.Vec3{X: math.Sin(theta) * math.Cos(phi), Y: math.Cos(theta), Z: math.Sin(theta) * math.Sin(phi)}
+	time := self.shutter.Time(sample.Time, sample.PFilm.Y/self.fullResolution.Y)
+	ray := core.NewRay(core.Point3{}, dir, math.Inf(1), time, self.medium)
+	return 1, self.cameraToWorld.ApplyR(ray)
+}
+
+func (self *EnvironmentCamera) GenerateRayDifferential(sample CameraSample) (float64, core.RayDifferential) {
+	return generateRayDifferential(self, sample)
+}
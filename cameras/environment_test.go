@@ -0,0 +1,36 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"testing"
+)
+
+// the top row of the film looks up +y, the bottom row down -y and the middle row
+// goes around the horizon starting from +x
+func TestEnvironmentCamera(t *testing.T) {
+	cameraToWorld := testCameraToWorld(false)
+	resolution := core.Point2{X: 64, Y: 32}
+	camera := NewEnvironmentCamera(cameraToWorld, NewShutter(0, 1, BoxShutterCurve(), 0), resolution, nil)
+	tests := []struct {
+		pFilm core.Point2
+		dir   core.Vec3
+	}{
+		{core.Point2{X: 0, Y: 0}, core.Vec3{Y: 1}},
+		{core.Point2{X: 64, Y: 0}, core.Vec3{Y: 1}},
+		{core.Point2{X: 0, Y: 32}, core.Vec3{Y: -1}},
+		{core.Point2{X: 64, Y: 32}, core.Vec3{Y: -1}},
+		{core.Point2{X: 0, Y: 16}, core.Vec3{X: 1}},
+		{core.Point2{X: 16, Y: 16}, core.Vec3{Z: 1}},
+		{core.Point2{X: 32, Y: 16}, core.Vec3{X: -1}},
+		{core.Point2{X: 48, Y: 16}, core.Vec3{Z: -1}},
+		{core.Point2{X: 64, Y: 16}, core.Vec3{X: 1}},
+		{core.Point2{X: 8, Y: 8}, core.Vec3{X: 0.5, Y: 0.7071067811865476, Z: 0.5}},
+	}
+	o := cameraToWorld.ApplyP(0, core.Point3{})
+	for _, test := range tests {
+		_, r := camera.GenerateRay(CameraSample{PFilm: test.pFilm})
+		if d := cameraToWorld.ApplyV(0, test.dir); !nearP(r.Orig, o) || !nearV(r.Dir, d) {
+			t.Errorf("%v: ray %v along %v, expected %v along %v", test.pFilm, r.Orig, r.Dir, o, d)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"math"
+)
+
+// OrthographicCamera projects along parallel rays down +z, the screen window is
+// the visible area in camera space units. A lens radius larger than 0 focuses
+// on the plane at focalDistance like a thin lens
+type OrthographicCamera struct {
+	camera projectiveCamera
+	// camera space offset of the ray origin for a one pixel step on the film
+	dxCamera, dyCamera core.Vec3
+}
+
+func NewOrthographicCamera(cameraToWorld *core.AnimatedTransform, shutter Shutter, screenWindow core.Bounds2,
+	fullResolution core.Point2, lensRadius, focalDistance float64, medium *media.Medium) *OrthographicCamera {
+	camera := newProjectiveCamera(cameraToWorld, shutter, core.Orthographic(0, 1), screenWindow, fullResolution,
+		lensRadius, focalDistance, medium)
+	// Compute differential changes in origin for orthographic camera rays
+	return &OrthographicCamera{
+		camera:   camera,
+		dxCamera: camera.rasterToCamera.ApplyV(core.Vec3{X: 1}),
+		dyCamera: camera.rasterToCamera.ApplyV(core.Vec3{Y: 1}),
+	}
+}
+
+func (self *OrthographicCamera) GenerateRay(sample CameraSample) (float64, core.Ray) {
+	// Compute raster and camera sample positions
+	pCamera := self.camera.rasterToCamera.ApplyP(core.Point3{X: sample.PFilm.X, Y: sample.PFilm.Y})
+	o, d := self.camera.thinLens(pCamera, core.Vec3{Z: 1}, sample.PLens)
+	ray := core.NewRay(o, d, math.Inf(1), self.camera.time(sample), self.camera.medium)
+	return 1, self.camera.cameraToWorld.ApplyR(ray)
+}
+
+func (self *OrthographicCamera) GenerateRayDifferential(sample CameraSample) (float64, core.RayDifferential) {
+	pCamera := self.camera.rasterToCamera.ApplyP(core.Point3{X: sample.PFilm.X, Y: sample.PFilm.Y})
+	o, d := self.camera.thinLens(pCamera, core.Vec3{Z: 1}, sample.PLens)
+	rd := core.NewRayDiff(o, d, math.Inf(1), self.camera.time(sample), self.camera.medium)
+
+	// Compute rays for the neighbouring pixels, through the same point on the lens
+	rd.RxOrigin, rd.RxDir = self.camera.thinLens(pCamera.AddV(self.dxCamera), core.Vec3{Z: 1}, sample.PLens)
+	rd.RyOrigin, rd.RyDir = self.camera.thinLens(pCamera.AddV(self.dyCamera), core.Vec3{Z: 1}, sample.PLens)
+	rd.HasDifferentials = true
+	return 1, self.camera.cameraToWorld.ApplyRD(rd)
+}
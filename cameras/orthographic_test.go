@@ -0,0 +1,46 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"testing"
+)
+
+// all rays leave the film along the camera's +z, the film maps onto the screen
+// window in camera space so a pixel step moves the origin by its size
+func TestOrthographicCamera(t *testing.T) {
+	cameraToWorld := testCameraToWorld(false)
+	camera := NewOrthographicCamera(cameraToWorld, NewShutter(0, 1, BoxShutterCurve(), 0), testScreenWindow,
+		testResolution, 0, 1e6, nil)
+	z := cameraToWorld.ApplyV(0, core.Vec3{Z: 1})
+	// raster y goes down while camera y goes up
+	dx := cameraToWorld.ApplyV(0, core.Vec3{X: 8.0 / 3 / testResolution.X})
+	dy := cameraToWorld.ApplyV(0, core.Vec3{Y: -2 / testResolution.Y})
+	tests := []struct {
+		pFilm   core.Point2
+		pCamera core.Point3
+	}{
+		{core.Point2{X: 32, Y: 24}, core.Point3{}},
+		{core.Point2{X: 0, Y: 0}, core.Point3{X: -4.0 / 3, Y: 1}},
+		{core.Point2{X: 64, Y: 48}, core.Point3{X: 4.0 / 3, Y: -1}},
+		{core.Point2{X: 16, Y: 36}, core.Point3{X: -2.0 / 3, Y: -0.5}},
+	}
+	for _, test := range tests {
+		sample := CameraSample{PFilm: test.pFilm, PLens: core.Point2{X: 0.5, Y: 0.5}}
+		_, r := camera.GenerateRay(sample)
+		if o := cameraToWorld.ApplyP(0, test.pCamera); !nearP(r.Orig, o) || !nearV(r.Dir, z) {
+			t.Errorf("%v: ray %v along %v, expected %v along %v", test.pFilm, r.Orig, r.Dir, o, z)
+		}
+		_, rd := camera.GenerateRayDifferential(sample)
+		if !rd.HasDifferentials || !nearP(rd.R.Orig, r.Orig) || !nearV(rd.R.Dir, z) {
+			t.Errorf("%v: differential ray %v, expected %v", test.pFilm, *rd.R, r)
+		}
+		if !nearV(rd.RxOrigin.SubtractP(r.Orig), dx) || !nearV(rd.RxDir, z) {
+			t.Errorf("%v: x differential %v along %v, expected offset %v along %v", test.pFilm,
+				rd.RxOrigin.SubtractP(r.Orig), rd.RxDir, dx, z)
+		}
+		if !nearV(rd.RyOrigin.SubtractP(r.Orig), dy) || !nearV(rd.RyDir, z) {
+			t.Errorf("%v: y differential %v along %v, expected offset %v along %v", test.pFilm,
+				rd.RyOrigin.SubtractP(r.Orig), rd.RyDir, dy, z)
+		}
+	}
+}
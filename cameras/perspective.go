@@ -0,0 +1,54 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"math"
+)
+
+/*
+PerspectiveCamera projects through a pinhole, or a thin lens when lensRadius is
+larger than 0 which keeps only the plane at focalDistance sharp. fov is the
+angle the shorter side of the screen window spans.
+*/
+type PerspectiveCamera struct {
+	camera projectiveCamera
+	// camera space offset of the ray direction for a one pixel step on the film
+	dxCamera, dyCamera core.Vec3
+}
+
+func NewPerspectiveCamera(cameraToWorld *core.AnimatedTransform, shutter Shutter, screenWindow core.Bounds2,
+	fullResolution core.Point2, lensRadius, focalDistance, fov float64,
+	medium *media.Medium) *PerspectiveCamera {
+	camera := newProjectiveCamera(cameraToWorld, shutter, core.Perspective(fov, 1e-2, 1000), screenWindow,
+		fullResolution, lensRadius, focalDistance, medium)
+	// Compute differential changes in origin for perspective camera rays
+	origin := camera.rasterToCamera.ApplyP(core.Point3{})
+	return &PerspectiveCamera{
+		camera:   camera,
+		dxCamera: camera.rasterToCamera.ApplyP(core.Point3{X: 1}).SubtractP(origin),
+		dyCamera: camera.rasterToCamera.ApplyP(core.Point3{Y: 1}).SubtractP(origin),
+	}
+}
+
+func (self *PerspectiveCamera) GenerateRay(sample CameraSample) (float64, core.Ray) {
+	// Compute raster and camera sample positions
+	pCamera := self.camera.rasterToCamera.ApplyP(core.Point3{X: sample.PFilm.X, Y: sample.PFilm.Y})
+	o, d := self.camera.thinLens(core.Point3{}, pCamera.ToVec().Normalize(), sample.PLens)
+	ray := core.NewRay(o, d, math.Inf(1), self.camera.time(sample), self.camera.medium)
+	return 1, self.camera.cameraToWorld.ApplyR(ray)
+}
+
+func (self *PerspectiveCamera) GenerateRayDifferential(sample CameraSample) (float64, core.RayDifferential) {
+	pCamera := self.camera.rasterToCamera.ApplyP(core.Point3{X: sample.PFilm.X, Y: sample.PFilm.Y})
+	o, d := self.camera.thinLens(core.Point3{}, pCamera.ToVec().Normalize(), sample.PLens)
+	rd := core.NewRayDiff(o, d, math.Inf(1), self.camera.time(sample), self.camera.medium)
+
+	// Compute rays for the neighbouring pixels, through the same point on the lens
+	rd.RxOrigin, rd.RxDir = self.camera.thinLens(core.Point3{}, pCamera.ToVec().Add(self.dxCamera).Normalize(),
+		sample.PLens)
+	rd.RyOrigin, rd.RyDir = self.camera.thinLens(core.Point3{}, pCamera.ToVec().Add(self.dyCamera).Normalize(),
+		sample.PLens)
+	rd.HasDifferentials = true
+	return 1, self.camera.cameraToWorld.ApplyRD(rd)
+}
@@ -0,0 +1,109 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"math"
+	"testing"
+)
+
+func nearV(a, b core.Vec3) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 && math.Abs(a.Z-b.Z) < 1e-9
+}
+
+func nearP(a, b core.Point3) bool {
+	return nearV(a.ToVec(), b.ToVec())
+}
+
+// testCameraToWorld places the camera off the origin looking down a tilted z,
+// moving along x over the shutter if moving is set
+func testCameraToWorld(moving bool) *core.AnimatedTransform {
+	start := core.ConcatTransforms(core.Translate(core.Vec3{X: 1, Y: 2, Z: 3}), core.RotateX(30))
+	end := start
+	if moving {
+		end = core.ConcatTransforms(core.Translate(core.Vec3{X: 4, Y: 2, Z: 3}), core.RotateX(30))
+	}
+	return core.NewAnimatedTransform(&start, 0, &end, 1)
+}
+
+var (
+	testResolution   = core.Point2{X: 64, Y: 48}
+	testScreenWindow = core.NewBounds2(core.Point2{X: -4.0 / 3, Y: -1}, core.Point2{X: 4.0 / 3, Y: 1})
+)
+
+// the ray through the middle of the film is the camera's +z axis
+func TestPerspectiveCameraFilmCenter(t *testing.T) {
+	cameraToWorld := testCameraToWorld(true)
+	camera := NewPerspectiveCamera(cameraToWorld, NewShutter(0, 1, BoxShutterCurve(), 0), testScreenWindow,
+		testResolution, 0, 1e6, 60, nil)
+	for _, time := range []float64{0, 0.25, 0.5} {
+		sample := CameraSample{PFilm: core.Point2{X: 32, Y: 24}, PLens: core.Point2{X: 0.5, Y: 0.5}, Time: time}
+		_, r := camera.GenerateRay(sample)
+		if r.Time != time {
+			t.Errorf("time %v: ray at time %v", time, r.Time)
+		}
+		if o := cameraToWorld.ApplyP(time, core.Point3{}); !nearP(r.Orig, o) {
+			t.Errorf("time %v: ray starts at %v, expected %v", time, r.Orig, o)
+		}
+		if d := cameraToWorld.ApplyV(time, core.Vec3{Z: 1}); !nearV(r.Dir, d) {
+			t.Errorf("time %v: ray goes along %v, expected %v", time, r.Dir, d)
+		}
+	}
+}
+
+// with a pinhole the differentials are exactly the rays of the next pixels
+func TestPerspectiveCameraDifferentials(t *testing.T) {
+	camera := NewPerspectiveCamera(testCameraToWorld(false), NewShutter(0, 1, BoxShutterCurve(), 0),
+		testScreenWindow, testResolution, 0, 1e6, 60, nil)
+	for _, pFilm := range []core.Point2{{X: 0, Y: 0}, {X: 32, Y: 24}, {X: 10.25, Y: 40.5}, {X: 63, Y: 1}} {
+		sample := CameraSample{PFilm: pFilm, PLens: core.Point2{X: 0.3, Y: 0.8}, Time: 0.5}
+		_, rd := camera.GenerateRayDifferential(sample)
+		_, r := camera.GenerateRay(sample)
+		if !rd.HasDifferentials || !nearP(rd.R.Orig, r.Orig) || !nearV(rd.R.Dir, r.Dir) {
+			t.Errorf("%v: differential ray %v, expected %v", pFilm, *rd.R, r)
+		}
+		sample.PFilm.X++
+		_, rx := camera.GenerateRay(sample)
+		if !nearP(rd.RxOrigin, rx.Orig) || !nearV(rd.RxDir, rx.Dir) {
+			t.Errorf("%v: x differential %v %v, expected %v %v", pFilm, rd.RxOrigin, rd.RxDir, rx.Orig, rx.Dir)
+		}
+		sample.PFilm.X--
+		sample.PFilm.Y++
+		_, ry := camera.GenerateRay(sample)
+		if !nearP(rd.RyOrigin, ry.Orig) || !nearV(rd.RyDir, ry.Dir) {
+			t.Errorf("%v: y differential %v %v, expected %v %v", pFilm, rd.RyOrigin, rd.RyDir, ry.Orig, ry.Dir)
+		}
+	}
+}
+
+// rays from every point on the lens meet the pinhole ray on the plane of focus
+func TestPerspectiveCameraThinLensFocus(t *testing.T) {
+	const lensRadius, focalDistance = 0.5, 7
+	cameraToWorld := testCameraToWorld(false)
+	worldToCamera := cameraToWorld.Interpolate(0).Inverse()
+	shutter := NewShutter(0, 1, BoxShutterCurve(), 0)
+	pinhole := NewPerspectiveCamera(cameraToWorld, shutter, testScreenWindow, testResolution, 0, focalDistance,
+		60, nil)
+	lens := NewPerspectiveCamera(cameraToWorld, shutter, testScreenWindow, testResolution, lensRadius,
+		focalDistance, 60, nil)
+
+	// where a world space ray crosses the plane of focus in camera space
+	onFocus := func(r core.Ray) (core.Point3, core.Point3) {
+		o, d := worldToCamera.ApplyP(r.Orig), worldToCamera.ApplyV(r.Dir)
+		return o, o.AddV(d.Multiply((focalDistance - o.Z) / d.Z))
+	}
+	for _, pFilm := range []core.Point2{{X: 32, Y: 24}, {X: 5, Y: 40}, {X: 60.5, Y: 3.25}} {
+		_, r := pinhole.GenerateRay(CameraSample{PFilm: pFilm})
+		_, focus := onFocus(r)
+		for _, pLens := range []core.Point2{{X: 0.1, Y: 0.1}, {X: 0.9, Y: 0.2}, {X: 0.4, Y: 0.95}, {X: 0.7, Y: 0.6}} {
+			_, r := lens.GenerateRay(CameraSample{PFilm: pFilm, PLens: pLens})
+			o, p := onFocus(r)
+			if rLens := math.Hypot(o.X, o.Y); math.Abs(o.Z) > 1e-9 || rLens == 0 || rLens > lensRadius+1e-9 {
+				t.Errorf("%v %v: ray starts at %v, not on the lens", pFilm, pLens, o)
+			}
+			if !nearP(p, focus) {
+				t.Errorf("%v %v: ray crosses the plane of focus at %v, the pinhole ray at %v", pFilm, pLens, p,
+					focus)
+			}
+		}
+	}
+}
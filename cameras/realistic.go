@@ -0,0 +1,418 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// lensElementInterface is one spherical surface of the lens system in meters, a
+// curvature radius of 0 is the aperture stop. eta is the index of refraction on
+// the scene side of the interface, 0 for air
+type lensElementInterface struct {
+	curvatureRadius float64
+	thickness       float64
+	eta             float64
+	apertureRadius  float64
+}
+
+/*
+RealisticCamera traces rays from the film through a system of spherical lens
+elements, which gives the defocus, vignetting and distortion of a real lens.
+Camera space has the film at z=0 and the lens system in front of it towards +z,
+the elements are listed from the scene side to the film side like in lens
+prescriptions. Rays are only sent towards the bounds of the exit pupil, the part
+of the rear element that light from the film gets through, which is precomputed
+for rings of points at increasing distances from the center of the film.
+*/
+type RealisticCamera struct {
+	cameraToWorld  *core.AnimatedTransform
+	shutter        Shutter
+	fullResolution core.Point2
+	// physical size of the film in meters
+	filmExtent      core.Bounds2
+	filmDiagonal    float64
+	simpleWeighting bool
+	medium          *media.Medium
+
+	elementInterfaces []lensElementInterface
+	exitPupilBounds   []core.Bounds2
+}
+
+/*
+NewRealisticCamera makes a camera for the lens described by lensData, four values
+per element: curvature radius, thickness, index of refraction and aperture
+diameter all in millimeters, like the filmDiagonal. The film is moved to where
+the plane at focusDistance is sharp. simpleWeighting only scales rays for
+vignetting instead of computing the radiometrically correct weight.
+*/
+func NewRealisticCamera(cameraToWorld *core.AnimatedTransform, shutter Shutter, fullResolution core.Point2,
+	filmDiagonal float64, lensData []float64, focusDistance float64, simpleWeighting bool,
+	medium *media.Medium) (*RealisticCamera, error) {
+	if len(lensData)%4 != 0 || len(lensData) == 0 {
+		return nil, fmt.Errorf("lens specification must have four values per element, read %d", len(lensData))
+	}
+	c := &RealisticCamera{
+		cameraToWorld:   cameraToWorld,
+		shutter:         shutter,
+		fullResolution:  fullResolution,
+		filmDiagonal:    filmDiagonal * 0.001,
+		simpleWeighting: simpleWeighting,
+		medium:          medium,
+	}
+	// the film has the aspect of the image and the given diagonal
+	aspect := fullResolution.Y / fullResolution.X
+	x := math.Sqrt(c.filmDiagonal * c.filmDiagonal / (1 + aspect*aspect))
+	y := aspect * x
+	c.filmExtent = core.NewBounds2(core.Point2{X: -x / 2, Y: -y / 2}, core.Point2{X: x / 2, Y: y / 2})
+
+	for i := 0; i < len(lensData); i += 4 {
+		c.elementInterfaces = append(c.elementInterfaces, lensElementInterface{
+			lensData[i] * 0.001, lensData[i+1] * 0.001, lensData[i+2], lensData[i+3] * 0.001 / 2})
+	}
+
+	// Compute lens--film distance for given focus distance
+	thickness, err := c.focusThickLens(focusDistance)
+	if err != nil {
+		return nil, err
+	}
+	c.elementInterfaces[len(c.elementInterfaces)-1].thickness = thickness
+
+	// Compute exit pupil bounds at sampled points on the film
+	const nSamples = 64
+	c.exitPupilBounds = make([]core.Bounds2, nSamples)
+	var wg sync.WaitGroup
+	for i := range c.exitPupilBounds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r0 := float64(i) / nSamples * c.filmDiagonal / 2
+			r1 := float64(i+1) / nSamples * c.filmDiagonal / 2
+			c.exitPupilBounds[i] = c.boundExitPupil(r0, r1)
+		}(i)
+	}
+	wg.Wait()
+	return c, nil
+}
+
+func (self *RealisticCamera) lensRearZ() float64 {
+	return self.elementInterfaces[len(self.elementInterfaces)-1].thickness
+}
+
+func (self *RealisticCamera) lensFrontZ() float64 {
+	zSum := 0.0
+	for _, element := range self.elementInterfaces {
+		zSum += element.thickness
+	}
+	return zSum
+}
+
+func (self *RealisticCamera) rearElementRadius() float64 {
+	return self.elementInterfaces[len(self.elementInterfaces)-1].apertureRadius
+}
+
+// the lens system is described looking from the film down -z, camera space looks
+// down +z so rays have their z flipped while they are traced through it
+func flipZ(r core.Ray) core.Ray {
+	return core.NewRay(core.Point3{X: r.Orig.X, Y: r.Orig.Y, Z: -r.Orig.Z},
+		core.Vec3{X: r.Dir.X, Y: r.Dir.Y, Z: -r.Dir.Z}, math.Inf(1), r.Time, nil)
+}
+
+// traceLensesFromFilm follows a camera space ray leaving the film through the
+// elements, it fails if the ray is blocked by an aperture or totally reflected
+func (self *RealisticCamera) traceLensesFromFilm(rCamera core.Ray) (bool, core.Ray) {
+	elementZ := 0.0
+	rLens := flipZ(rCamera)
+	for i := len(self.elementInterfaces) - 1; i >= 0; i-- {
+		element := self.elementInterfaces[i]
+		// Update ray from film accounting for interaction with element
+		elementZ -= element.thickness
+
+		// Compute intersection of ray with lens element
+		var t float64
+		var n core.Normal3
+		isStop := element.curvatureRadius == 0
+		if isStop {
+			// a ray turned away from the stop by the elements behind it never reaches it
+			if rLens.Dir.Z >= 0 {
+				return false, core.Ray{}
+			}
+			t = (elementZ - rLens.Orig.Z) / rLens.Dir.Z
+		} else {
+			radius := element.curvatureRadius
+			zCenter := elementZ + element.curvatureRadius
+			var ok bool
+			if ok, t, n = intersectSphericalElement(radius, zCenter, rLens); !ok {
+				return false, core.Ray{}
+			}
+		}
+
+		// Test intersection point against element aperture
+		pHit := rLens.GetPointForT(t)
+		if pHit.X*pHit.X+pHit.Y*pHit.Y > element.apertureRadius*element.apertureRadius {
+			return false, core.Ray{}
+		}
+		rLens.Orig = pHit
+
+		// Update ray path for element interface interaction
+		if !isStop {
+			etaI := 1.0
+			if element.eta != 0 {
+				etaI = element.eta
+			}
+			etaT := 1.0
+			if i > 0 && self.elementInterfaces[i-1].eta != 0 {
+				etaT = self.elementInterfaces[i-1].eta
+			}
+			ok, w := core.Refract(rLens.Dir.Normalize().Inverse(), n, etaI/etaT)
+			if !ok {
+				return false, core.Ray{}
+			}
+			rLens.Dir = w
+		}
+	}
+	return true, flipZ(rLens)
+}
+
+// traceLensesFromScene is traceLensesFromFilm the other way, for a ray entering
+// the front element
+func (self *RealisticCamera) traceLensesFromScene(rCamera core.Ray) (bool, core.Ray) {
+	elementZ := -self.lensFrontZ()
+	rLens := flipZ(rCamera)
+	for i, element := range self.elementInterfaces {
+		// Compute intersection of ray with lens element
+		var t float64
+		var n core.Normal3
+		isStop := element.curvatureRadius == 0
+		if isStop {
+			if rLens.Dir.Z <= 0 {
+				return false, core.Ray{}
+			}
+			t = (elementZ - rLens.Orig.Z) / rLens.Dir.Z
+		} else {
+			radius := element.curvatureRadius
+			zCenter := elementZ + element.curvatureRadius
+			var ok bool
+			if ok, t, n = intersectSphericalElement(radius, zCenter, rLens); !ok {
+				return false, core.Ray{}
+			}
+		}
+
+		// Test intersection point against element aperture
+		pHit := rLens.GetPointForT(t)
+		if pHit.X*pHit.X+pHit.Y*pHit.Y > element.apertureRadius*element.apertureRadius {
+			return false, core.Ray{}
+		}
+		rLens.Orig = pHit
+
+		// Update ray path for from-scene element interface interaction
+		if !isStop {
+			etaI := 1.0
+			if i > 0 && self.elementInterfaces[i-1].eta != 0 {
+				etaI = self.elementInterfaces[i-1].eta
+			}
+			etaT := 1.0
+			if element.eta != 0 {
+				etaT = element.eta
+			}
+			ok, w := core.Refract(rLens.Dir.Normalize().Inverse(), n, etaI/etaT)
+			if !ok {
+				return false, core.Ray{}
+			}
+			rLens.Dir = w
+		}
+		elementZ += element.thickness
+	}
+	return true, flipZ(rLens)
+}
+
+// intersectSphericalElement finds where r meets the sphere of the element, on the
+// side of the sphere that is part of the lens, the normal faces against r
+func intersectSphericalElement(radius, zCenter float64, r core.Ray) (bool, float64, core.Normal3) {
+	// Compute t0 and t1 for ray--element intersection
+	o := r.Orig.SubtractV(core.Vec3{Z: zCenter})
+	d := r.Dir
+	A := d.X*d.X + d.Y*d.Y + d.Z*d.Z
+	B := 2 * (d.X*o.X + d.Y*o.Y + d.Z*o.Z)
+	C := o.X*o.X + o.Y*o.Y + o.Z*o.Z - radius*radius
+	ok, t0, t1 := core.Quadratic(A, B, C)
+	if !ok {
+		return false, 0, core.Normal3{}
+	}
+
+	// Select intersection t based on ray direction and element curvature
+	useCloserT := (d.Z > 0) != (radius < 0)
+	t := t1
+	if useCloserT {
+		t = t0
+	}
+	if t < 0 {
+		return false, 0, core.Normal3{}
+	}
+
+	// Compute surface normal of element at ray intersection point
+	n := core.NormalFromVec3(o.ToVec().Add(d.Multiply(t))).Normalize()
+	return true, t, core.FaceForward(&n, d.Inverse())
+}
+
+// computeCardinalPoints finds the z of the principal plane and the focal point of
+// the side rOut leaves from, rIn is parallel to the axis
+func computeCardinalPoints(rIn, rOut core.Ray) (float64, float64) {
+	tf := -rOut.Orig.X / rOut.Dir.X
+	fz := -rOut.GetPointForT(tf).Z
+	tp := (rIn.Orig.X - rOut.Orig.X) / rOut.Dir.X
+	pz := -rOut.GetPointForT(tp).Z
+	return pz, fz
+}
+
+// computeThickLensApproximation traces a ray parallel to the axis through the
+// lenses in each direction to find the principal planes and focal points
+func (self *RealisticCamera) computeThickLensApproximation() ([2]float64, [2]float64, error) {
+	var pz, fz [2]float64
+	// Find height x from optical axis for parallel rays
+	x := 0.001 * self.filmDiagonal
+
+	// Compute cardinal points for film side of lens system
+	rScene := core.NewRay(core.Point3{X: x, Z: self.lensFrontZ() + 1}, core.Vec3{Z: -1}, math.Inf(1), 0, nil)
+	ok, rFilm := self.traceLensesFromScene(rScene)
+	if !ok {
+		return pz, fz, fmt.Errorf("unable to trace ray from scene to film for thick lens approximation, " +
+			"is the aperture stop extremely small?")
+	}
+	pz[0], fz[0] = computeCardinalPoints(rScene, rFilm)
+
+	// Compute cardinal points for scene side of lens system
+	rFilm = core.NewRay(core.Point3{X: x, Z: self.lensRearZ() - 1}, core.Vec3{Z: 1}, math.Inf(1), 0, nil)
+	if ok, rScene = self.traceLensesFromFilm(rFilm); !ok {
+		return pz, fz, fmt.Errorf("unable to trace ray from film to scene for thick lens approximation, " +
+			"is the aperture stop extremely small?")
+	}
+	pz[1], fz[1] = computeCardinalPoints(rFilm, rScene)
+	return pz, fz, nil
+}
+
+// focusThickLens is the distance from the rear element to the film that focuses
+// on the plane at focusDistance, using the thick lens equation
+func (self *RealisticCamera) focusThickLens(focusDistance float64) (float64, error) {
+	pz, fz, err := self.computeThickLensApproximation()
+	if err != nil {
+		return 0, err
+	}
+	// Compute translation of lens, delta, to focus at focusDistance
+	f := fz[0] - pz[0]
+	z := -focusDistance
+	c := (pz[1] - z - pz[0]) * (pz[1] - z - 4*f - pz[0])
+	if c <= 0 {
+		return 0, fmt.Errorf("focus distance %v is too short for the lens system", focusDistance)
+	}
+	delta := 0.5 * (pz[1] - z + pz[0] - math.Sqrt(c))
+	return self.elementInterfaces[len(self.elementInterfaces)-1].thickness + delta, nil
+}
+
+// boundExitPupil bounds the points on the rear element that rays from film points
+// between pFilmX0 and pFilmX1 along x get through the lenses from
+func (self *RealisticCamera) boundExitPupil(pFilmX0, pFilmX1 float64) core.Bounds2 {
+	pupilBounds := core.NewEmptyBounds2()
+	const nSamples = 1024 * 1024
+	nExitingRays := 0
+
+	// Compute bounding box of projection of rear element on sampling plane
+	rearRadius := self.rearElementRadius()
+	projRearBounds := core.NewBounds2(core.Point2{X: -1.5 * rearRadius, Y: -1.5 * rearRadius},
+		core.Point2{X: 1.5 * rearRadius, Y: 1.5 * rearRadius})
+	for i := uint64(0); i < nSamples; i++ {
+		// Find location of sample points on x segment and rear lens element
+		pFilm := core.Point3{X: core.Lerp((float64(i)+0.5)/nSamples, pFilmX0, pFilmX1)}
+		u := core.Point2{X: radicalInverse(2, i), Y: radicalInverse(3, i)}
+		pRear2 := projRearBounds.Lerp(u)
+		pRear := core.Point3{X: pRear2.X, Y: pRear2.Y, Z: self.lensRearZ()}
+
+		// Expand pupil bounds if ray makes it through the lens system
+		if pupilBounds.Contains(pRear2) {
+			nExitingRays++
+			continue
+		}
+		ray := core.NewRay(pFilm, pRear.SubtractP(pFilm), math.Inf(1), 0, nil)
+		if ok, _ := self.traceLensesFromFilm(ray); ok {
+			pupilBounds = core.UnionB2P(pupilBounds, pRear2)
+			nExitingRays++
+		}
+	}
+
+	// Return entire element bounds if no rays made it through the lens system
+	if nExitingRays == 0 {
+		return projRearBounds
+	}
+
+	// Expand bounds to account for sample spacing
+	return core.ExpandB2(pupilBounds, 2*projRearBounds.Diagonal().Magnitude()/math.Sqrt(nSamples))
+}
+
+// sampleExitPupil picks the point on the rear element to trace towards from pFilm
+// and returns it with the area of the bounds it was chosen from
+func (self *RealisticCamera) sampleExitPupil(pFilm, lensSample core.Point2) (core.Point3, float64) {
+	// Find exit pupil bound for sample distance from film center
+	rFilm := math.Sqrt(pFilm.X*pFilm.X + pFilm.Y*pFilm.Y)
+	rIndex := int(rFilm / (self.filmDiagonal / 2) * float64(len(self.exitPupilBounds)))
+	if rIndex > len(self.exitPupilBounds)-1 {
+		rIndex = len(self.exitPupilBounds) - 1
+	}
+	pupilBounds := self.exitPupilBounds[rIndex]
+
+	// Generate sample point inside exit pupil bound
+	pLens := pupilBounds.Lerp(lensSample)
+
+	// Return sample point rotated by angle of pFilm with +x axis
+	sinTheta, cosTheta := 0.0, 1.0
+	if rFilm != 0 {
+		sinTheta, cosTheta = pFilm.Y/rFilm, pFilm.X/rFilm
+	}
+	return core.Point3{X: cosTheta*pLens.X - sinTheta*pLens.Y, Y: sinTheta*pLens.X + cosTheta*pLens.Y,
+		Z: self.lensRearZ()}, pupilBounds.SurfaceArea()
+}
+
+func (self *RealisticCamera) GenerateRay(sample CameraSample) (float64, core.Ray) {
+	// Find point on film, pFilm, corresponding to sample.PFilm
+	s := core.Point2{X: sample.PFilm.X / self.fullResolution.X, Y: sample.PFilm.Y / self.fullResolution.Y}
+	pFilm2 := self.filmExtent.Lerp(s)
+	pFilm := core.Point3{X: -pFilm2.X, Y: pFilm2.Y}
+
+	// Trace ray from pFilm through lens system
+	pRear, exitPupilBoundsArea := self.sampleExitPupil(core.Point2{X: pFilm.X, Y: pFilm.Y}, sample.PLens)
+	time := self.shutter.Time(sample.Time, s.Y)
+	rFilm := core.NewRay(pFilm, pRear.SubtractP(pFilm), math.Inf(1), time, nil)
+	ok, rOut := self.traceLensesFromFilm(rFilm)
+	if !ok {
+		return 0, core.Ray{}
+	}
+	ray := core.NewRay(rOut.Orig, rOut.Dir.Normalize(), math.Inf(1), time, self.medium)
+
+	// Compute weighting for RealisticCamera ray
+	cosTheta := rFilm.Dir.Normalize().Z
+	cos4Theta := (cosTheta * cosTheta) * (cosTheta * cosTheta)
+	weight := self.shutter.Duration() * cos4Theta * exitPupilBoundsArea / (self.lensRearZ() * self.lensRearZ())
+	if self.simpleWeighting {
+		weight = cos4Theta * exitPupilBoundsArea / self.exitPupilBounds[0].SurfaceArea()
+	}
+	return weight, self.cameraToWorld.ApplyR(ray)
+}
+
+func (self *RealisticCamera) GenerateRayDifferential(sample CameraSample) (float64, core.RayDifferential) {
+	return generateRayDifferential(self, sample)
+}
+
+// radicalInverse mirrors the digits of a in the given base around the radix point
+func radicalInverse(base, a uint64) float64 {
+	invBase := 1 / float64(base)
+	reversedDigits, invBaseN := uint64(0), 1.0
+	for a > 0 {
+		next := a / base
+		digit := a - next*base
+		reversedDigits = reversedDigits*base + digit
+		invBaseN *= invBase
+		a = next
+	}
+	return math.Min(float64(reversedDigits)*invBaseN, math.Nextafter(1, 0))
+}
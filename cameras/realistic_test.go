@@ -0,0 +1,69 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"math"
+	"testing"
+)
+
+// testLens is an aperture stop in front of a biconvex lens of about 51mm focal
+// length, focused on focusDistance. The exit pupil bounds aren't computed
+func testLens(t *testing.T, focusDistance float64) *RealisticCamera {
+	t.Helper()
+	c := &RealisticCamera{
+		filmDiagonal: 0.035,
+		elementInterfaces: []lensElementInterface{
+			{0, 0.005, 0, 0.004},
+			{0.05, 0.005, 1.5, 0.01},
+			{-0.05, 0.05, 0, 0.01},
+		},
+	}
+	thickness, err := c.focusThickLens(focusDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.elementInterfaces[len(c.elementInterfaces)-1].thickness = thickness
+	return c
+}
+
+// rays from a point on the axis at the focus distance meet again on the film,
+// within 10 microns, a fraction of a pixel. Only paraxial ones as the thick lens
+// approximation ignores aberrations
+func TestRealisticCameraFocus(t *testing.T) {
+	for _, focusDistance := range []float64{0.3, 1, 10} {
+		c := testLens(t, focusDistance)
+		for _, h := range []float64{-0.0002, 0.0001, 0.0002} {
+			pScene := core.Point3{Z: focusDistance}
+			pFront := core.Point3{X: h, Z: c.lensFrontZ()}
+			ok, r := c.traceLensesFromScene(core.NewRay(pScene, pFront.SubtractP(pScene), math.Inf(1), 0, nil))
+			if !ok {
+				t.Fatalf("focus %v: ray through %v is blocked", focusDistance, pFront)
+			}
+			if z := r.GetPointForT(-r.Orig.X / r.Dir.X).Z; math.Abs(z) > 1e-5 {
+				t.Errorf("focus %v: ray through %v crosses the axis %v from the film", focusDistance, pFront, z)
+			}
+		}
+	}
+	if _, err := testLens(t, 1).focusThickLens(0.1); err == nil {
+		t.Errorf("focused closer than the lens allows")
+	}
+}
+
+// the stop narrows what gets through to a disk around the axis, well inside the
+// rear element
+func TestRealisticCameraExitPupil(t *testing.T) {
+	c := testLens(t, 1)
+	rearRadius := c.rearElementRadius()
+	b := c.boundExitPupil(0, c.filmDiagonal/2/64)
+	pMin, pMax := b.Get(0), b.Get(1)
+	if pMin.X >= pMax.X || pMin.Y >= pMax.Y {
+		t.Fatalf("empty exit pupil %v", b)
+	}
+	if pMin.X <= -1.5*rearRadius || pMin.Y <= -1.5*rearRadius || pMax.X >= 1.5*rearRadius ||
+		pMax.Y >= 1.5*rearRadius {
+		t.Errorf("exit pupil %v isn't smaller than the rear element", b)
+	}
+	if pMin.X > 0 || pMin.Y > 0 || pMax.X < 0 || pMax.Y < 0 || math.Abs(pMin.Y+pMax.Y) > 1e-4 {
+		t.Errorf("exit pupil %v isn't around the axis", b)
+	}
+}
@@ -0,0 +1,125 @@
+package cameras
+
+import (
+	"Anvil/core"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+ShutterCurve is how far open the shutter is over the exposure, linear between
+knots at times in [0, 1]. Ray times are sampled proportionally to it so a
+partially open shutter lets through less of the motion instead of weighting rays
+down.
+*/
+type ShutterCurve struct {
+	times, values []float64
+	// integral of the curve up to each knot, normalized to end at 1
+	cdf []float64
+}
+
+func newShutterCurve(times, values []float64) (ShutterCurve, error) {
+	cdf := make([]float64, len(times))
+	for i := 1; i < len(times); i++ {
+		cdf[i] = cdf[i-1] + (values[i-1]+values[i])/2*(times[i]-times[i-1])
+	}
+	total := cdf[len(cdf)-1]
+	if total <= 0 {
+		return ShutterCurve{}, fmt.Errorf("shutter curve is never open")
+	}
+	for i := range cdf {
+		cdf[i] /= total
+	}
+	return ShutterCurve{times, values, cdf}, nil
+}
+
+// BoxShutterCurve opens the shutter fully for the whole exposure
+func BoxShutterCurve() ShutterCurve {
+	return ShutterCurve{[]float64{0, 1}, []float64{1, 1}, []float64{0, 1}}
+}
+
+// TrapezoidShutterCurve opens linearly over the first ramp of the exposure and
+// closes over the last, ramp is in (0, 0.5]
+func TrapezoidShutterCurve(ramp float64) (ShutterCurve, error) {
+	if ramp <= 0 || ramp > 0.5 {
+		return ShutterCurve{}, fmt.Errorf("shutter ramp %v must be in (0, 0.5]", ramp)
+	}
+	return newShutterCurve([]float64{0, ramp, 1 - ramp, 1}, []float64{0, 1, 1, 0})
+}
+
+// TabulatedShutterCurve has knots at evenly spaced times with the given values
+func TabulatedShutterCurve(values []float64) (ShutterCurve, error) {
+	if len(values) < 2 {
+		return ShutterCurve{}, fmt.Errorf("shutter curve needs at least two values, got %d", len(values))
+	}
+	times := make([]float64, len(values))
+	for i, v := range values {
+		if v < 0 {
+			return ShutterCurve{}, fmt.Errorf("shutter curve value %v is negative", v)
+		}
+		times[i] = float64(i) / float64(len(values)-1)
+	}
+	return newShutterCurve(times, append([]float64(nil), values...))
+}
+
+// Sample maps u in [0, 1) to a time in [0, 1] distributed like the curve by
+// inverting its integral
+func (c ShutterCurve) Sample(u float64) float64 {
+	// Find the segment the sample falls in, segments that are closed have no width in the cdf
+	i := sort.SearchFloat64s(c.cdf, u)
+	if i == 0 {
+		i = 1
+	} else if i >= len(c.cdf) {
+		i = len(c.cdf) - 1
+	}
+	t0, dt := c.times[i-1], c.times[i]-c.times[i-1]
+	v0, v1 := c.values[i-1], c.values[i]
+	segment := c.cdf[i] - c.cdf[i-1]
+	if segment <= 0 {
+		return t0
+	}
+
+	// the integral over the segment is quadratic, solve for the fraction s where it
+	// reaches the part of u left in the segment
+	target := (u - c.cdf[i-1]) / segment * (v0 + v1) / 2
+	var s float64
+	if slope := v1 - v0; math.Abs(slope) < 1e-9*math.Max(v0, v1) {
+		s = target / v0
+	} else {
+		s = (math.Sqrt(math.Max(0, v0*v0+2*slope*target)) - v0) / slope
+	}
+	return t0 + core.Clamp(s, 0, 1)*dt
+}
+
+/*
+Shutter turns the time of a camera sample into the time its ray is traced at,
+between the shutter opening and closing. With a rolling shutter the rows of the
+film aren't exposed at the same time: the exposure of each row is the part
+1-rollingDuration of the interval and it starts later for each row down the film,
+the bottom row starting when the top one is rollingDuration into the interval.
+*/
+type Shutter struct {
+	open, close     float64
+	curve           ShutterCurve
+	rollingDuration float64
+}
+
+func NewShutter(open, close float64, curve ShutterCurve, rollingDuration float64) Shutter {
+	return Shutter{open, close, curve, core.Clamp(rollingDuration, 0, 1)}
+}
+
+// Time is the ray time for sample time u in [0, 1) on film row filmY, which is 0
+// at the top of the film and 1 at the bottom
+func (s Shutter) Time(u, filmY float64) float64 {
+	t := s.curve.Sample(u)
+	if s.rollingDuration > 0 {
+		t = core.Clamp(filmY, 0, 1)*s.rollingDuration + t*(1-s.rollingDuration)
+	}
+	return core.Lerp(t, s.open, s.close)
+}
+
+// Duration is how long the shutter is open over the whole film
+func (s Shutter) Duration() float64 {
+	return s.close - s.open
+}
@@ -0,0 +1,108 @@
+package cameras
+
+import (
+	"math"
+	"testing"
+)
+
+// value of the curve at t, linear between the knots
+func (c ShutterCurve) at(t float64) float64 {
+	for i := 1; i < len(c.times); i++ {
+		if t <= c.times[i] {
+			s := (t - c.times[i-1]) / (c.times[i] - c.times[i-1])
+			return c.values[i-1] + s*(c.values[i]-c.values[i-1])
+		}
+	}
+	return c.values[len(c.values)-1]
+}
+
+// the fraction of stratified samples falling in each bin of time has to match
+// the fraction of the curve's integral over it
+func TestShutterCurveSample(t *testing.T) {
+	mustCurve := func(c ShutterCurve, err error) ShutterCurve {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name  string
+		curve ShutterCurve
+	}{
+		{"box", BoxShutterCurve()},
+		{"trapezoid", mustCurve(TrapezoidShutterCurve(0.25))},
+		{"triangle", mustCurve(TrapezoidShutterCurve(0.5))},
+		{"starts closed", mustCurve(TabulatedShutterCurve([]float64{0, 0, 1, 1}))},
+		{"closed in the middle", mustCurve(TabulatedShutterCurve([]float64{1, 0, 0, 2}))},
+		{"ramps", mustCurve(TabulatedShutterCurve([]float64{0, 1, 0.25, 3, 0}))},
+	}
+
+	const bins, n, steps = 16, 64000, 100
+	for _, test := range tests {
+		var hist [bins]float64
+		for i := 0; i < n; i++ {
+			time := test.curve.Sample((float64(i) + 0.5) / n)
+			if time < 0 || time > 1 || test.curve.at(time) <= 0 && i > 0 && i < n-1 {
+				t.Fatalf("%s: sample %d at time %v where the shutter is closed", test.name, i, time)
+			}
+			hist[int(math.Min(time*bins, bins-1))] += 1.0 / n
+		}
+
+		var expected [bins]float64
+		total := 0.0
+		for i := range expected {
+			for j := 0; j < steps; j++ {
+				expected[i] += test.curve.at((float64(i) + (float64(j)+0.5)/steps) / bins)
+			}
+			total += expected[i]
+		}
+		for i := range expected {
+			if expected[i] /= total; math.Abs(hist[i]-expected[i]) > 1e-3 {
+				t.Errorf("%s: bin %d has %v of the samples, expected %v", test.name, i, hist[i], expected[i])
+			}
+		}
+	}
+}
+
+func TestShutterCurveErrors(t *testing.T) {
+	for _, ramp := range []float64{0, -0.1, 0.6} {
+		if _, err := TrapezoidShutterCurve(ramp); err == nil {
+			t.Errorf("ramp %v accepted", ramp)
+		}
+	}
+	for _, values := range [][]float64{nil, {1}, {0, 0, 0}, {1, -1, 1}} {
+		if _, err := TabulatedShutterCurve(values); err == nil {
+			t.Errorf("shutter curve %v accepted", values)
+		}
+	}
+}
+
+// with a rolling shutter every row is exposed for its own part of the interval,
+// later down the film
+func TestShutterTime(t *testing.T) {
+	trapezoid, err := TrapezoidShutterCurve(0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const open, close = 2.0, 5.0
+	for _, rolling := range []float64{0, 0.3, 1} {
+		for _, curve := range []ShutterCurve{BoxShutterCurve(), trapezoid} {
+			s := NewShutter(open, close, curve, rolling)
+			for _, filmY := range []float64{0, 0.25, 0.5, 1} {
+				rowOpen := open + filmY*rolling*(close-open)
+				rowClose := rowOpen + (1-rolling)*(close-open)
+				for i := 0; i < 1000; i++ {
+					u := (float64(i) + 0.5) / 1000
+					time := s.Time(u, filmY)
+					if time < open || time > close {
+						t.Fatalf("rolling %v: time %v outside of the shutter [%v, %v]", rolling, time, open, close)
+					}
+					if time < rowOpen-1e-12 || time > rowClose+1e-12 {
+						t.Fatalf("rolling %v: time %v of row %v outside of its exposure [%v, %v]",
+							rolling, time, filmY, rowOpen, rowClose)
+					}
+				}
+			}
+		}
+	}
+}
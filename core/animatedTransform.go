@@ -0,0 +1,238 @@
+package core
+
+import "math"
+
+/*
+AnimatedTransform moves between two transforms over the shutter interval for
+motion blur. Interpolating matrices directly would shear and shrink rotating
+objects, so both transforms are decomposed into translation, rotation and scale
+which are interpolated separately: linearly for translation and scale and along
+the great arc for the rotation quaternion.
+*/
+type AnimatedTransform struct {
+	startTransform, endTransform *Transform
+	startTime, endTime           float64
+	actuallyAnimated             bool
+	hasRotation                  bool
+	t                            [2]Vec3
+	r                            [2]Quaternion
+	s                            [2]Matrix4x4f
+}
+
+func NewAnimatedTransform(startTransform *Transform, startTime float64,
+	endTransform *Transform, endTime float64) *AnimatedTransform {
+	a := &AnimatedTransform{
+		startTransform:   startTransform,
+		endTransform:     endTransform,
+		startTime:        startTime,
+		endTime:          endTime,
+		actuallyAnimated: !IsEqualTransform(*startTransform, *endTransform),
+	}
+	if !a.actuallyAnimated {
+		return a
+	}
+	a.t[0], a.r[0], a.s[0] = Decompose(startTransform.m)
+	a.t[1], a.r[1], a.s[1] = Decompose(endTransform.m)
+	// Flip r[1] if needed to select shortest path
+	if DotQ(a.r[0], a.r[1]) < 0 {
+		a.r[1] = a.r[1].Multiply(-1)
+	}
+	a.hasRotation = DotQ(a.r[0], a.r[1]) < 0.9995
+	return a
+}
+
+/*
+Decompose splits an affine matrix into M = T R S. T is the last column, R is found
+by polar decomposition of the rest: averaging it with its inverse transpose
+converges to the closest rotation. S = R^-1 M is whatever is left, usually a
+scale but it can hold shear too. A mirroring M converges to a reflection, which
+is negated to get a rotation and leave the mirroring to S.
+*/
+func Decompose(m Matrix4x4f) (Vec3, Quaternion, Matrix4x4f) {
+	t := Vec3{m[0][3], m[1][3], m[2][3]}
+
+	// Compute new transformation matrix M without translation
+	M := m
+	for i := 0; i < 3; i++ {
+		M[i][3], M[3][i] = 0, 0
+	}
+	M[3][3] = 1
+
+	// Extract rotation R from transformation matrix
+	R := M
+	for count := 0; count < 100; count++ {
+		// Compute next matrix in series
+		_, rInv := R.Transpose().Inverse()
+		var rNext Matrix4x4f
+		for i := 0; i < 4; i++ {
+			for j := 0; j < 4; j++ {
+				rNext[i][j] = 0.5 * (R[i][j] + rInv[i][j])
+			}
+		}
+		// Compute norm of difference between R and rNext
+		norm := 0.0
+		for i := 0; i < 3; i++ {
+			n := math.Abs(R[i][0]-rNext[i][0]) + math.Abs(R[i][1]-rNext[i][1]) + math.Abs(R[i][2]-rNext[i][2])
+			norm = math.Max(norm, n)
+		}
+		R = rNext
+		if norm < 0.0001 {
+			break
+		}
+	}
+	det := R[0][0]*(R[1][1]*R[2][2]-R[1][2]*R[2][1]) - R[0][1]*(R[1][0]*R[2][2]-R[1][2]*R[2][0]) +
+		R[0][2]*(R[1][0]*R[2][1]-R[1][1]*R[2][0])
+	if det < 0 {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				R[i][j] = -R[i][j]
+			}
+		}
+	}
+	_, rInv := R.Inverse()
+	return t, NewQuaternionFromTransform(Transform{R, R.Transpose()}), MulMat4x4f(&rInv, &M)
+}
+
+// Interpolate is the transform at the given time, times outside the interval
+// are clamped to it
+func (a *AnimatedTransform) Interpolate(time float64) Transform {
+	if !a.actuallyAnimated || time <= a.startTime {
+		return *a.startTransform
+	}
+	if time >= a.endTime {
+		return *a.endTransform
+	}
+	dt := (time - a.startTime) / (a.endTime - a.startTime)
+	trans := a.t[0].Multiply(1 - dt).Add(a.t[1].Multiply(dt))
+	rotate := Slerp(dt, a.r[0], a.r[1])
+	var scale Matrix4x4f
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			scale[i][j] = Lerp(dt, a.s[0][i][j], a.s[1][i][j])
+		}
+	}
+	scale[3][3] = 1
+	return ConcatTransforms(ConcatTransforms(Translate(trans), rotate.ToTransform()),
+		NewTransformFromMat(scale))
+}
+
+// ApplyR transforms a ray with the transform at the ray's time
+func (a *AnimatedTransform) ApplyR(r Ray) Ray {
+	t := a.Interpolate(r.Time)
+	return t.ApplyR(r)
+}
+
+func (a *AnimatedTransform) ApplyRD(rd RayDifferential) RayDifferential {
+	t := a.Interpolate(rd.R.Time)
+	return t.ApplyRD(rd)
+}
+
+func (a *AnimatedTransform) ApplyP(time float64, p Point3) Point3 {
+	t := a.Interpolate(time)
+	return t.ApplyP(p)
+}
+
+func (a *AnimatedTransform) ApplyV(time float64, v Vec3) Vec3 {
+	t := a.Interpolate(time)
+	return t.ApplyV(v)
+}
+
+func (a *AnimatedTransform) IsAnimated() bool {
+	return a.actuallyAnimated
+}
+
+func (a *AnimatedTransform) HasScale() bool {
+	return a.startTransform.HasScale() || a.endTransform.HasScale()
+}
+
+// MotionBounds bounds b over the whole interval, everything is affine in the
+// point so bounding the motion of the corners is enough
+func (a *AnimatedTransform) MotionBounds(b Bounds3) Bounds3 {
+	if !a.actuallyAnimated {
+		return a.startTransform.ApplyB(b)
+	}
+	if !a.hasRotation {
+		return UnionB3B3(a.startTransform.ApplyB(b), a.endTransform.ApplyB(b))
+	}
+	bounds := NewEmptyBounds3()
+	for corner := 0; corner < 8; corner++ {
+		bounds = UnionB3B3(bounds, a.BoundPointMotion(b.Corner(corner)))
+	}
+	return bounds
+}
+
+/*
+BoundPointMotion bounds the path of p. The interpolated transform is
+T(t) Rot(axis, angle*t) R0 S(t) with the rotation about a fixed axis, the point is
+bounded over the scale, rotation and translation separately: S(t) p stays on the
+segment between its ends, rotating each end sweeps an arc around the axis and
+the translation adds the box around its two ends.
+*/
+func (a *AnimatedTransform) BoundPointMotion(p Point3) Bounds3 {
+	if !a.actuallyAnimated {
+		return NewSinglePBounds3(a.startTransform.ApplyP(p))
+	}
+	if !a.hasRotation {
+		return UnionB3P(NewSinglePBounds3(a.startTransform.ApplyP(p)), a.endTransform.ApplyP(p))
+	}
+
+	// Find the axis and angle of the rotation from r[0] to r[1], as seen after r[0]
+	r0 := a.r[0].ToTransform()
+	r1 := a.r[1].ToTransform()
+	w := MulMat4x4f(&r1.m, &r0.mInv)
+	axis := Vec3{w[2][1] - w[1][2], w[0][2] - w[2][0], w[1][0] - w[0][1]}
+	angle := 2 * math.Acos(Clamp(DotQ(a.r[0], a.r[1]), -1, 1))
+	if axis.Magnitude() < 1e-6 {
+		// a half turn has no preferred direction, use the whole circle around the
+		// axis of the symmetric part
+		col := 0
+		for i := 1; i < 3; i++ {
+			if w[i][i] > w[col][col] {
+				col = i
+			}
+		}
+		axis = Vec3{w[0][col], w[1][col], w[2][col]}.Add([3]Vec3{
+			GetBasisVec3X(), GetBasisVec3Y(), GetBasisVec3Z()}[col])
+		angle = 2 * math.Pi
+	}
+	axis = axis.Normalize()
+
+	arc := NewEmptyBounds3()
+	for _, s := range a.s {
+		sp := Point3{s[0][0]*p.X + s[0][1]*p.Y + s[0][2]*p.Z,
+			s[1][0]*p.X + s[1][1]*p.Y + s[1][2]*p.Z,
+			s[2][0]*p.X + s[2][1]*p.Y + s[2][2]*p.Z}
+		arc = UnionB3B3(arc, arcBounds(r0.ApplyP(sp).ToVec(), axis, angle))
+	}
+	tMin, tMax := MinCompsVec(a.t[0], a.t[1]), MaxCompsVec(a.t[0], a.t[1])
+	// pad for the rounding of the interpolation
+	bounds := ExpandB3(NewBounds3(arc.pMin.AddV(tMin), arc.pMax.AddV(tMax)),
+		Gamma(8)*arc.Diagonal().Add(tMax.Subtract(tMin)).Magnitude())
+	// the ends are the exact transforms, which the decomposition only reproduces
+	// up to rounding
+	bounds = UnionB3P(bounds, a.startTransform.ApplyP(p))
+	return UnionB3P(bounds, a.endTransform.ApplyP(p))
+}
+
+// arcBounds bounds x rotated about axis by every angle in [0, angle]. Each
+// coordinate is c + u cos(phi) + v sin(phi) which is extreme at the ends of the arc
+// or where its derivative is zero
+func arcBounds(x, axis Vec3, angle float64) Bounds3 {
+	c := axis.Multiply(DotV3(x, axis))
+	u := x.Subtract(c)
+	v := CrossV3(axis, u)
+	at := func(phi float64) Point3 {
+		return Point3{}.AddV(c.Add(u.Multiply(math.Cos(phi))).Add(v.Multiply(math.Sin(phi))))
+	}
+	bounds := UnionB3P(NewSinglePBounds3(at(0)), at(angle))
+	for i := 0; i < 3; i++ {
+		phi := math.Atan2(v.Get(i), u.Get(i))
+		for _, zero := range [2]float64{phi, phi + math.Pi} {
+			zero = math.Mod(zero+2*math.Pi, 2*math.Pi)
+			if zero <= angle {
+				bounds = UnionB3P(bounds, at(zero))
+			}
+		}
+	}
+	return bounds
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func insideB3(p Point3, b Bounds3) bool {
+	return p.X >= b.pMin.X && p.X <= b.pMax.X && p.Y >= b.pMin.Y && p.Y <= b.pMax.Y &&
+		p.Z >= b.pMin.Z && p.Z <= b.pMax.Z
+}
+
+// every point of the box along the interpolated path has to be inside MotionBounds
+func TestMotionBoundsContainsPath(t *testing.T) {
+	concat := func(ts ...Transform) Transform {
+		ret := NewTransform()
+		for _, t := range ts {
+			ret = ConcatTransforms(ret, t)
+		}
+		return ret
+	}
+	tests := []struct {
+		name       string
+		start, end Transform
+	}{
+		{"translate", Translate(Vec3{X: -1}), Translate(Vec3{X: 2, Y: 1, Z: -3})},
+		{"scale", Scale(1, 1, 1), Scale(0.5, 2, 3)},
+		{"mirror", Scale(1, 1, 1), Scale(0.5, 2, -3)},
+		{"quarter turn", RotateZ(0), concat(Translate(Vec3{Y: 2}), RotateZ(90))},
+		{"half turn", RotateX(10), RotateFromAxis(190, Vec3{X: 1, Y: 0.5})},
+		{"rotate and scale", concat(RotateFromAxis(30, Vec3{X: 1, Y: 2, Z: 3}), Scale(1, 2, 0.5)),
+			concat(Translate(Vec3{X: 1, Y: -2, Z: 5}), RotateFromAxis(170, Vec3{X: -1, Y: 0.5, Z: 2}),
+				Scale(3, 0.2, 1))},
+		{"rotate off origin", concat(Translate(Vec3{X: 5}), RotateY(-40)),
+			concat(Translate(Vec3{X: 5, Z: 1}), RotateY(120), Scale(2, 2, 2))},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	box := NewBounds3(Point3{X: -1, Y: 0.5, Z: -2}, Point3{X: 2, Y: 1.5, Z: 0.5})
+	for _, test := range tests {
+		start, end := test.start, test.end
+		a := NewAnimatedTransform(&start, 0, &end, 1)
+		bounds := a.MotionBounds(box)
+		for i := 0; i < 2000; i++ {
+			p := box.Corner(i % 8)
+			if i >= 8 {
+				p = Point3{X: Lerp(rng.Float64(), box.pMin.X, box.pMax.X),
+					Y: Lerp(rng.Float64(), box.pMin.Y, box.pMax.Y),
+					Z: Lerp(rng.Float64(), box.pMin.Z, box.pMax.Z)}
+			}
+			time := rng.Float64()
+			m := a.Interpolate(time)
+			if q := m.ApplyP(p); !insideB3(q, bounds) {
+				t.Errorf("%s: %v at time %v moves to %v outside of %v", test.name, p, time, q, bounds)
+				break
+			}
+		}
+	}
+}
@@ -11,6 +11,14 @@ type Bounds3 struct {
 	pMin, pMax Point3
 }
 
+// returns pMin for 0 and pMax for 1
+func (b Bounds3) Get(i int) Point3 {
+	if i == 0 {
+		return b.pMin
+	}
+	return b.pMax
+}
+
 // returns the point for one of the 8 corners of the BB
 func (b Bounds3) Corner(i int) Point3 {
 	var pX, pY, pZ float64
@@ -99,11 +107,7 @@ func (b Bounds3) BoundingSphere() (Point3, float64) {
 	return center, radius
 }
 
-/*
-TODO: create intersect that takes precomputed reciprocal and vector of 3 booleans
-that are true if the direction along that axis is negative. PBRT says ~15% increase
-in performance when using BVHAccel
-*/
+// IntersectP returns the parametric range of the ray inside the box
 func (b Bounds3) IntersectP(ray Ray) (bool, float64, float64) {
 	t0 := float64(0)
 	t1 := ray.tMax
@@ -115,8 +119,9 @@ func (b Bounds3) IntersectP(ray Ray) (bool, float64, float64) {
 		if tNear > tFar {
 			tNear, tFar = tFar, tNear
 		}
-		//TODO: update tFar to be more robust
-		if tNear > 0 {
+		// make tFar conservative so rounding errors can't miss grazing hits
+		tFar *= 1 + 2*Gamma(3)
+		if tNear > t0 {
 			t0 = tNear
 		}
 		if tFar < t1 {
@@ -129,6 +134,48 @@ func (b Bounds3) IntersectP(ray Ray) (bool, float64, float64) {
 	return true, t0, t1
 }
 
+/*
+IntersectPInv is a faster IntersectP for testing one ray against many boxes.
+invDir is the reciprocal of the ray direction and dirIsNeg is 1 for the axes
+along which the direction is negative, so the near and far slabs can be picked
+without comparisons. PBRT reports ~15% better performance when using BVHAccel
+*/
+func (b Bounds3) IntersectPInv(ray Ray, invDir Vec3, dirIsNeg [3]int) bool {
+	// Check for ray intersection against x and y slabs
+	tMin := (b.Get(dirIsNeg[0]).X - ray.Orig.X) * invDir.X
+	tMax := (b.Get(1-dirIsNeg[0]).X - ray.Orig.X) * invDir.X
+	tyMin := (b.Get(dirIsNeg[1]).Y - ray.Orig.Y) * invDir.Y
+	tyMax := (b.Get(1-dirIsNeg[1]).Y - ray.Orig.Y) * invDir.Y
+
+	// Update tMax and tyMax to ensure robust bounds intersection
+	tMax *= 1 + 2*Gamma(3)
+	tyMax *= 1 + 2*Gamma(3)
+	if tMin > tyMax || tyMin > tMax {
+		return false
+	}
+	if tyMin > tMin {
+		tMin = tyMin
+	}
+	if tyMax < tMax {
+		tMax = tyMax
+	}
+
+	// Check for ray intersection against z slab
+	tzMin := (b.Get(dirIsNeg[2]).Z - ray.Orig.Z) * invDir.Z
+	tzMax := (b.Get(1-dirIsNeg[2]).Z - ray.Orig.Z) * invDir.Z
+	tzMax *= 1 + 2*Gamma(3)
+	if tMin > tzMax || tzMin > tMax {
+		return false
+	}
+	if tzMin > tMin {
+		tMin = tzMin
+	}
+	if tzMax < tMax {
+		tMax = tzMax
+	}
+	return tMin < ray.tMax && tMax > 0
+}
+
 func NewEmptyBounds3() Bounds3 {
 	ret := Bounds3{}
 	min := float64(math.MinInt32)
@@ -181,6 +228,13 @@ type Bounds2 struct {
 	pMin, pMax Point2
 }
 
+func (b Bounds2) Get(i int) Point2 {
+	if i == 0 {
+		return b.pMin
+	}
+	return b.pMax
+}
+
 // returns the point for one of the 8 corners of the BB
 func (b Bounds2) Corner(i int) Point2 {
 	var pX, pY float64
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// random boxes and rays through the unit cube, the same for both benchmarks
+func benchmarkBoxesAndRays() ([]Bounds3, []Ray) {
+	rng := rand.New(rand.NewSource(1))
+	randomPoint := func() Point3 {
+		return Point3{X: rng.Float64(), Y: rng.Float64(), Z: rng.Float64()}
+	}
+	boxes := make([]Bounds3, 1024)
+	for i := range boxes {
+		p := randomPoint()
+		boxes[i] = NewBounds3(p, p.AddV(Vec3{X: 0.1, Y: 0.1, Z: 0.1}))
+	}
+	rays := make([]Ray, 64)
+	for i := range rays {
+		o := Point3{X: rng.Float64()*4 - 2, Y: rng.Float64()*4 - 2, Z: -2}
+		rays[i] = NewRay(o, randomPoint().SubtractP(o).Normalize(), math.Inf(1), 0, nil)
+	}
+	return boxes, rays
+}
+
+func rayInverse(r Ray) (Vec3, [3]int) {
+	invDir := Vec3{X: 1 / r.Dir.X, Y: 1 / r.Dir.Y, Z: 1 / r.Dir.Z}
+	var dirIsNeg [3]int
+	for axis := 0; axis < 3; axis++ {
+		if invDir.Get(axis) < 0 {
+			dirIsNeg[axis] = 1
+		}
+	}
+	return invDir, dirIsNeg
+}
+
+// keeps the compiler from dropping the benchmarked intersections
+var benchmarkHits int
+
+func BenchmarkBounds3IntersectP(b *testing.B) {
+	boxes, rays := benchmarkBoxesAndRays()
+	hits := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := rays[i%len(rays)]
+		for _, box := range boxes {
+			if ok, _, _ := box.IntersectP(r); ok {
+				hits++
+			}
+		}
+	}
+	benchmarkHits = hits
+}
+
+func BenchmarkBounds3IntersectPInv(b *testing.B) {
+	boxes, rays := benchmarkBoxesAndRays()
+	hits := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := rays[i%len(rays)]
+		// computed once per ray like the accelerators do
+		invDir, dirIsNeg := rayInverse(r)
+		for _, box := range boxes {
+			if box.IntersectPInv(r, invDir, dirIsNeg) {
+				hits++
+			}
+		}
+	}
+	benchmarkHits = hits
+}
+
+// both tests must agree on which boxes are hit
+func TestBounds3IntersectPInv(t *testing.T) {
+	boxes, rays := benchmarkBoxesAndRays()
+	for _, r := range rays {
+		invDir, dirIsNeg := rayInverse(r)
+		for _, box := range boxes {
+			ok, _, _ := box.IntersectP(r)
+			if okInv := box.IntersectPInv(r, invDir, dirIsNeg); ok != okInv {
+				t.Errorf("box %v ray %v: IntersectP %v, IntersectPInv %v", box, r, ok, okInv)
+			}
+		}
+	}
+}
+
+// a direction component of -0 has a reciprocal of -Inf, the slabs along it have
+// to be ordered like for a negative direction
+func TestBounds3IntersectPInvSignedZero(t *testing.T) {
+	negZero := math.Copysign(0, -1)
+	box := NewBounds3(Point3{X: -1, Y: -1, Z: -1}, Point3{X: 1, Y: 1, Z: 1})
+	for _, dir := range []Vec3{{X: negZero, Y: 0, Z: 1}, {X: 0, Y: negZero, Z: 1}, {X: negZero, Y: negZero, Z: -1},
+		{X: 1, Y: negZero, Z: negZero}} {
+		r := NewRay(Point3{X: 0.5, Y: 0.5, Z: 0.5}.AddV(dir.Multiply(-5)), dir, math.Inf(1), 0, nil)
+		invDir, dirIsNeg := rayInverse(r)
+		if !box.IntersectPInv(r, invDir, dirIsNeg) {
+			t.Errorf("ray with direction %v misses the box it goes through", dir)
+		}
+	}
+}
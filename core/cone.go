@@ -0,0 +1,98 @@
+package core
+
+import "math"
+
+// Cone has its base of the given radius at z = 0 and its apex at z = height
+type Cone struct {
+	shape                  ShapeData
+	radius, height, phiMax float64
+}
+
+func NewCone(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	height, radius, phiMax float64) Cone {
+	return Cone{
+		NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Cone"),
+		radius, height, phiMax}
+}
+
+func (self Cone) ObjectBound() Bounds3 {
+	r := self.radius
+	return NewBounds3(Point3{-r, -r, 0}, Point3{r, r, self.height})
+}
+func (self Cone) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
+func (self Cone) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	// Transform ray to object space
+	ray, oErr, dErr := self.shape.WorldToObject.ApplyRE(r)
+
+	// Compute quadratic cone coefficients
+	ox, oy, oz, dx, dy, dz := rayEFloats(ray, oErr, dErr)
+	k := NewEFloat(self.radius, 0).Divide(NewEFloat(self.height, 0))
+	k = k.Multiply(k)
+	ozh := oz.Subtract(NewEFloat(self.height, 0))
+	a := dx.Multiply(dx).Add(dy.Multiply(dy)).Subtract(k.Multiply(dz).Multiply(dz))
+	b := dx.Multiply(ox).Add(dy.Multiply(oy)).Subtract(k.Multiply(dz).Multiply(ozh)).Scale(2)
+	c := ox.Multiply(ox).Add(oy.Multiply(oy)).Subtract(k.Multiply(ozh).Multiply(ozh))
+
+	// Solve for t values
+	ret, t0, t1 := QuadraticE(a, b, c)
+	if !ret || t0.UpperBound() > ray.tMax || t1.LowerBound() <= 0 {
+		return false, 0, SurfaceInteraction{}
+	}
+	tShapeHit := t0
+	if tShapeHit.LowerBound() <= 0 {
+		tShapeHit = t1
+		if tShapeHit.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Compute cone hit point and phi
+	getPosAndPhi := func(tsh float64) (Point3, float64) {
+		p := ray.GetPointForT(tsh)
+		phi := math.Atan2(p.Y, p.X)
+		if phi < 0 {
+			phi += 2 * math.Pi
+		}
+		return p, phi
+	}
+	pHit, phi := getPosAndPhi(tShapeHit.Float64())
+
+	// Test cone intersection against clipping parameters, this also rejects the
+	// mirrored cone above the apex
+	if pHit.Z < 0 || pHit.Z > self.height || phi > self.phiMax {
+		if tShapeHit == t1 || t1.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+		tShapeHit = t1
+		pHit, phi = getPosAndPhi(tShapeHit.Float64())
+		if pHit.Z < 0 || pHit.Z > self.height || phi > self.phiMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Find parametric representation of cone hit
+	u := phi / self.phiMax
+	v := pHit.Z / self.height
+	dpdu := Vec3{-self.phiMax * pHit.Y, self.phiMax * pHit.X, 0}
+	dpdv := Vec3{-pHit.X / (1 - v), -pHit.Y / (1 - v), self.height}
+
+	d2Pduu := Vec3{pHit.X, pHit.Y, 0}.Multiply(-self.phiMax * self.phiMax)
+	d2Pduv := Vec3{pHit.Y, -pHit.X, 0}.Multiply(self.phiMax / (1 - v))
+	dndu, dndv := weingarten(dpdu, dpdv, d2Pduu, d2Pduv, Vec3{})
+
+	// Compute error bounds for the intersection point
+	pError := hitError(ox, oy, oz, dx, dy, dz, tShapeHit)
+
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv,
+		dndu, dndv, &self.shape)
+	si = self.shape.ObjectToWorld.ApplySI(si)
+	return true, tShapeHit.Float64(), si
+}
+func (self Cone) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	return intersectP(self, ray, testAlphaTexture)
+}
+func (self Cone) Area() float64 {
+	return self.radius * math.Sqrt(self.height*self.height+self.radius*self.radius) * self.phiMax / 2
+}
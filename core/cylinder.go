@@ -0,0 +1,99 @@
+package core
+
+import "math"
+
+// Cylinder is centered on the z axis, it has no caps
+type Cylinder struct {
+	shape                      ShapeData
+	radius, zMin, zMax, phiMax float64
+}
+
+func NewCylinder(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	radius, zMin, zMax, phiMax float64) Cylinder {
+	return Cylinder{
+		NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Cylinder"),
+		radius, math.Min(zMin, zMax), math.Max(zMin, zMax), phiMax}
+}
+
+func (self Cylinder) ObjectBound() Bounds3 {
+	r := self.radius
+	return NewBounds3(Point3{-r, -r, self.zMin}, Point3{r, r, self.zMax})
+}
+func (self Cylinder) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
+func (self Cylinder) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	// Transform ray to object space
+	ray, oErr, dErr := self.shape.WorldToObject.ApplyRE(r)
+
+	// Compute quadratic cylinder coefficients
+	ox, oy, _, dx, dy, _ := rayEFloats(ray, oErr, dErr)
+	radius := NewEFloat(self.radius, 0)
+	a := dx.Multiply(dx).Add(dy.Multiply(dy))
+	b := dx.Multiply(ox).Add(dy.Multiply(oy)).Scale(2)
+	c := ox.Multiply(ox).Add(oy.Multiply(oy)).Subtract(radius.Multiply(radius))
+
+	// Solve for t values
+	ret, t0, t1 := QuadraticE(a, b, c)
+	if !ret || t0.UpperBound() > ray.tMax || t1.LowerBound() <= 0 {
+		return false, 0, SurfaceInteraction{}
+	}
+	tShapeHit := t0
+	if tShapeHit.LowerBound() <= 0 {
+		tShapeHit = t1
+		if tShapeHit.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Compute cylinder hit point and phi
+	getPosAndPhi := func(tsh float64) (Point3, float64) {
+		p := ray.GetPointForT(tsh)
+		// Refine cylinder intersection point
+		hitRad := math.Sqrt(p.X*p.X + p.Y*p.Y)
+		p.X *= self.radius / hitRad
+		p.Y *= self.radius / hitRad
+		phi := math.Atan2(p.Y, p.X)
+		if phi < 0 {
+			phi += 2 * math.Pi
+		}
+		return p, phi
+	}
+	pHit, phi := getPosAndPhi(tShapeHit.Float64())
+
+	// Test cylinder intersection against clipping parameters
+	if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+		if tShapeHit == t1 || t1.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+		tShapeHit = t1
+		pHit, phi = getPosAndPhi(tShapeHit.Float64())
+		if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Find parametric representation of cylinder hit
+	u := phi / self.phiMax
+	v := (pHit.Z - self.zMin) / (self.zMax - self.zMin)
+	dpdu := Vec3{-self.phiMax * pHit.Y, self.phiMax * pHit.X, 0}
+	dpdv := Vec3{0, 0, self.zMax - self.zMin}
+
+	// the cylinder only curves around phi
+	d2Pduu := Vec3{pHit.X, pHit.Y, 0}.Multiply(-self.phiMax * self.phiMax)
+	dndu, dndv := weingarten(dpdu, dpdv, d2Pduu, Vec3{}, Vec3{})
+
+	// the hit point was reprojected onto the cylinder, only that rounding is left
+	pError := Vec3{math.Abs(pHit.X), math.Abs(pHit.Y), 0}.Multiply(Gamma(3))
+
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv,
+		dndu, dndv, &self.shape)
+	si = self.shape.ObjectToWorld.ApplySI(si)
+	return true, tShapeHit.Float64(), si
+}
+func (self Cylinder) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	return intersectP(self, ray, testAlphaTexture)
+}
+func (self Cylinder) Area() float64 {
+	return (self.zMax - self.zMin) * self.radius * self.phiMax
+}
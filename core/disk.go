@@ -0,0 +1,72 @@
+package core
+
+import "math"
+
+// Disk is a disk or annulus at height z = height, facing +z
+type Disk struct {
+	shape                               ShapeData
+	height, radius, innerRadius, phiMax float64
+}
+
+func NewDisk(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	height, radius, innerRadius, phiMax float64) Disk {
+	return Disk{
+		NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Disk"),
+		height, radius, innerRadius, phiMax}
+}
+
+func (self Disk) ObjectBound() Bounds3 {
+	r := self.radius
+	return NewBounds3(Point3{-r, -r, self.height}, Point3{r, r, self.height})
+}
+func (self Disk) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
+func (self Disk) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	// Transform ray to object space
+	ray := self.shape.WorldToObject.ApplyR(r)
+
+	// Compute plane intersection for disk, rays parallel to it miss
+	if ray.Dir.Z == 0 {
+		return false, 0, SurfaceInteraction{}
+	}
+	tShapeHit := (self.height - ray.Orig.Z) / ray.Dir.Z
+	if tShapeHit <= 0 || tShapeHit >= ray.tMax {
+		return false, 0, SurfaceInteraction{}
+	}
+
+	// See if hit point is inside disk radii and phiMax
+	pHit := ray.GetPointForT(tShapeHit)
+	dist2 := pHit.X*pHit.X + pHit.Y*pHit.Y
+	if dist2 > self.radius*self.radius || dist2 < self.innerRadius*self.innerRadius {
+		return false, 0, SurfaceInteraction{}
+	}
+	phi := math.Atan2(pHit.Y, pHit.X)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	if phi > self.phiMax {
+		return false, 0, SurfaceInteraction{}
+	}
+
+	// Find parametric representation of disk hit
+	u := phi / self.phiMax
+	rHit := math.Sqrt(dist2)
+	v := (self.radius - rHit) / (self.radius - self.innerRadius)
+	dpdu := Vec3{-self.phiMax * pHit.Y, self.phiMax * pHit.X, 0}
+	dpdv := Vec3{pHit.X, pHit.Y, 0}.Multiply((self.innerRadius - self.radius) / rHit)
+
+	// Refine disk intersection point
+	pHit.Z = self.height
+
+	si := NewSurfaceInteraction(pHit, Vec3{}, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv,
+		Normal3{}, Normal3{}, &self.shape)
+	si = self.shape.ObjectToWorld.ApplySI(si)
+	return true, tShapeHit, si
+}
+func (self Disk) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	return intersectP(self, ray, testAlphaTexture)
+}
+func (self Disk) Area() float64 {
+	return self.phiMax * 0.5 * (self.radius*self.radius - self.innerRadius*self.innerRadius)
+}
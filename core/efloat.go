@@ -0,0 +1,125 @@
+package core
+
+import "math"
+
+/*
+EFloat is a float64 that keeps track of the rounding error it has accumulated.
+Each operation rounds its bounds outward so that [low, high] always contains the
+value that exact arithmetic on the inputs would have given. Shapes use it to
+bound the error of their intersection points so rays leaving a surface can be
+offset just enough to not hit it again.
+*/
+type EFloat struct {
+	v, low, high float64
+}
+
+// NewEFloat is v known to be within err of the exact value
+func NewEFloat(v, err float64) EFloat {
+	if err == 0 {
+		return EFloat{v, v, v}
+	}
+	return EFloat{v, NextFloatDown(v - err), NextFloatUp(v + err)}
+}
+
+// NextFloatUp is the smallest float64 greater than v
+func NextFloatUp(v float64) float64 {
+	return math.Nextafter(v, math.Inf(1))
+}
+
+// NextFloatDown is the largest float64 smaller than v
+func NextFloatDown(v float64) float64 {
+	return math.Nextafter(v, math.Inf(-1))
+}
+
+func (e EFloat) Float64() float64 {
+	return e.v
+}
+
+func (e EFloat) LowerBound() float64 {
+	return e.low
+}
+
+func (e EFloat) UpperBound() float64 {
+	return e.high
+}
+
+// AbsoluteError is the widest the value can be off by
+func (e EFloat) AbsoluteError() float64 {
+	return NextFloatUp(math.Max(math.Abs(e.high-e.v), math.Abs(e.v-e.low)))
+}
+
+func (e EFloat) Add(f EFloat) EFloat {
+	return EFloat{e.v + f.v, NextFloatDown(e.low + f.low), NextFloatUp(e.high + f.high)}
+}
+
+func (e EFloat) Subtract(f EFloat) EFloat {
+	return EFloat{e.v - f.v, NextFloatDown(e.low - f.high), NextFloatUp(e.high - f.low)}
+}
+
+func (e EFloat) Multiply(f EFloat) EFloat {
+	prod := [4]float64{e.low * f.low, e.high * f.low, e.low * f.high, e.high * f.high}
+	return EFloat{e.v * f.v,
+		NextFloatDown(math.Min(math.Min(prod[0], prod[1]), math.Min(prod[2], prod[3]))),
+		NextFloatUp(math.Max(math.Max(prod[0], prod[1]), math.Max(prod[2], prod[3])))}
+}
+
+// Divide gives infinite bounds when f may be zero
+func (e EFloat) Divide(f EFloat) EFloat {
+	if f.low < 0 && f.high > 0 {
+		return EFloat{e.v / f.v, math.Inf(-1), math.Inf(1)}
+	}
+	div := [4]float64{e.low / f.low, e.high / f.low, e.low / f.high, e.high / f.high}
+	return EFloat{e.v / f.v,
+		NextFloatDown(math.Min(math.Min(div[0], div[1]), math.Min(div[2], div[3]))),
+		NextFloatUp(math.Max(math.Max(div[0], div[1]), math.Max(div[2], div[3])))}
+}
+
+// Scale multiplies by a constant that is exact
+func (e EFloat) Scale(f float64) EFloat {
+	return e.Multiply(EFloat{f, f, f})
+}
+
+func (e EFloat) Negate() EFloat {
+	return EFloat{-e.v, -e.high, -e.low}
+}
+
+func (e EFloat) Abs() EFloat {
+	switch {
+	case e.low >= 0:
+		return e
+	case e.high <= 0:
+		return e.Negate()
+	}
+	return EFloat{math.Abs(e.v), 0, math.Max(-e.low, e.high)}
+}
+
+// Sqrt of the non negative part of the interval
+func (e EFloat) Sqrt() EFloat {
+	return EFloat{math.Sqrt(e.v), NextFloatDown(math.Sqrt(math.Max(0, e.low))), NextFloatUp(math.Sqrt(e.high))}
+}
+
+/*
+QuadraticE solves a t^2 + b t + c = 0 like Quadratic does, with the returned t0 <= t1
+bounding the exact roots. The discriminant is computed with EFloats too since
+float64 is all there is, it can lose most of its precision to cancellation.
+*/
+func QuadraticE(a, b, c EFloat) (bool, EFloat, EFloat) {
+	disc := b.Multiply(b).Subtract(a.Multiply(c).Scale(4))
+	if disc.v < 0 {
+		return false, EFloat{}, EFloat{}
+	}
+	rootDisc := disc.Sqrt()
+
+	// Compute quadratic t values avoiding cancellation between b and the root
+	var q EFloat
+	if b.v < 0 {
+		q = b.Subtract(rootDisc).Scale(-0.5)
+	} else {
+		q = b.Add(rootDisc).Scale(-0.5)
+	}
+	t0, t1 := q.Divide(a), c.Divide(q)
+	if t0.v > t1.v {
+		t0, t1 = t1, t0
+	}
+	return true, t0, t1
+}
@@ -2,6 +2,9 @@ package core
 
 import "math"
 
+// ShadowEpsilon keeps rays spawned towards a point from reaching it
+const ShadowEpsilon = 0.0001
+
 func MachineEpsilon() float64 {
 	return math.Nextafter(1, 2) - 1
 }
@@ -34,6 +37,8 @@ func Clamp(v, min, max float64) (ret float64) {
 		ret = min
 	} else if v > max {
 		ret = max
+	} else {
+		ret = v
 	}
 	return ret
 }
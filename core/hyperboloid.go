@@ -0,0 +1,158 @@
+package core
+
+import "math"
+
+/*
+Hyperboloid is the surface swept by rotating the line segment p1 p2 around the z
+axis: a hyperboloid of one sheet, a cylinder or a cone depending on the segment.
+The squared distance to the axis along a line is quadratic in z, so the surface
+is x^2 + y^2 = ah*z^2 + bh*z + ch. Segments at constant z sweep a flat annulus
+that this can't represent, p1.z must differ from p2.z.
+*/
+type Hyperboloid struct {
+	shape                    ShapeData
+	p1, p2                   Point3
+	zMin, zMax, phiMax, rMax float64
+	ah, bh, ch               float64
+}
+
+func NewHyperboloid(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	point1, point2 Point3, phiMax float64) Hyperboloid {
+	radius1 := math.Sqrt(point1.X*point1.X + point1.Y*point1.Y)
+	radius2 := math.Sqrt(point2.X*point2.X + point2.Y*point2.Y)
+
+	// Compute implicit function coefficients from r^2 = A v^2 + B v + C along the
+	// segment with v = (z - p1.z) / dz
+	d := point2.SubtractP(point1)
+	A := d.X*d.X + d.Y*d.Y
+	B := 2 * (point1.X*d.X + point1.Y*d.Y)
+	C := radius1 * radius1
+	z1, dz := point1.Z, d.Z
+	return Hyperboloid{
+		shape:  NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Hyperboloid"),
+		p1:     point1,
+		p2:     point2,
+		zMin:   math.Min(point1.Z, point2.Z),
+		zMax:   math.Max(point1.Z, point2.Z),
+		phiMax: phiMax,
+		rMax:   math.Max(radius1, radius2),
+		ah:     A / (dz * dz),
+		bh:     B/dz - 2*z1*A/(dz*dz),
+		ch:     C - B*z1/dz + A*z1*z1/(dz*dz),
+	}
+}
+
+func (self Hyperboloid) ObjectBound() Bounds3 {
+	r := self.rMax
+	return NewBounds3(Point3{-r, -r, self.zMin}, Point3{r, r, self.zMax})
+}
+func (self Hyperboloid) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
+func (self Hyperboloid) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	// Transform ray to object space
+	ray, oErr, dErr := self.shape.WorldToObject.ApplyRE(r)
+
+	// Compute quadratic hyperboloid coefficients
+	ox, oy, oz, dx, dy, dz := rayEFloats(ray, oErr, dErr)
+	ah, bh, ch := NewEFloat(self.ah, 0), NewEFloat(self.bh, 0), NewEFloat(self.ch, 0)
+	a := dx.Multiply(dx).Add(dy.Multiply(dy)).Subtract(ah.Multiply(dz).Multiply(dz))
+	b := dx.Multiply(ox).Add(dy.Multiply(oy)).Subtract(ah.Multiply(dz).Multiply(oz)).Scale(2).
+		Subtract(bh.Multiply(dz))
+	c := ox.Multiply(ox).Add(oy.Multiply(oy)).Subtract(ah.Multiply(oz).Multiply(oz)).
+		Subtract(bh.Multiply(oz)).Subtract(ch)
+
+	// Solve for t values
+	ret, t0, t1 := QuadraticE(a, b, c)
+	if !ret || t0.UpperBound() > ray.tMax || t1.LowerBound() <= 0 {
+		return false, 0, SurfaceInteraction{}
+	}
+	tShapeHit := t0
+	if tShapeHit.LowerBound() <= 0 {
+		tShapeHit = t1
+		if tShapeHit.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Compute hyperboloid hit position and phi, phi is measured from the point on
+	// the segment at the same height
+	getPosAndPhi := func(tsh float64) (Point3, float64, float64) {
+		p := ray.GetPointForT(tsh)
+		v := (p.Z - self.p1.Z) / (self.p2.Z - self.p1.Z)
+		pr := self.p1.Multiply(1 - v).AddP(self.p2.Multiply(v))
+		phi := math.Atan2(pr.X*p.Y-p.X*pr.Y, p.X*pr.X+p.Y*pr.Y)
+		if phi < 0 {
+			phi += 2 * math.Pi
+		}
+		return p, phi, v
+	}
+	pHit, phi, v := getPosAndPhi(tShapeHit.Float64())
+
+	// Test hyperboloid intersection against clipping parameters
+	if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+		if tShapeHit == t1 || t1.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+		tShapeHit = t1
+		pHit, phi, v = getPosAndPhi(tShapeHit.Float64())
+		if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Find parametric representation of hyperboloid hit
+	u := phi / self.phiMax
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	d := self.p2.SubtractP(self.p1)
+	dpdu := Vec3{-self.phiMax * pHit.Y, self.phiMax * pHit.X, 0}
+	dpdv := Vec3{d.X*cosPhi - d.Y*sinPhi, d.X*sinPhi + d.Y*cosPhi, d.Z}
+
+	// the surface is ruled so it has no curvature along v
+	d2Pduu := Vec3{pHit.X, pHit.Y, 0}.Multiply(-self.phiMax * self.phiMax)
+	d2Pduv := Vec3{-dpdv.Y, dpdv.X, 0}.Multiply(self.phiMax)
+	dndu, dndv := weingarten(dpdu, dpdv, d2Pduu, d2Pduv, Vec3{})
+
+	// Compute error bounds for the intersection point
+	pError := hitError(ox, oy, oz, dx, dy, dz, tShapeHit)
+
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv,
+		dndu, dndv, &self.shape)
+	si = self.shape.ObjectToWorld.ApplySI(si)
+	return true, tShapeHit.Float64(), si
+}
+func (self Hyperboloid) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	return intersectP(self, ray, testAlphaTexture)
+}
+
+/*
+Area of the surface of revolution of the segment: phiMax times the integral over
+v of r * sqrt(r'^2 + z'^2) where r(v)^2 = A v^2 + B v + C. The integrand is the
+square root of a quadratic a v^2 + b v + c which has a closed form integral.
+*/
+func (self Hyperboloid) Area() float64 {
+	d := self.p2.SubtractP(self.p1)
+	A := d.X*d.X + d.Y*d.Y
+	B := 2 * (self.p1.X*d.X + self.p1.Y*d.Y)
+	C := self.p1.X*self.p1.X + self.p1.Y*self.p1.Y
+	dz2 := d.Z * d.Z
+	a := A * (A + dz2)
+	b := B * (A + dz2)
+	c := B*B/4 + C*dz2
+	if a == 0 {
+		// the segment is parallel to the axis
+		return self.phiMax * math.Sqrt(c)
+	}
+
+	sqrtA := math.Sqrt(a)
+	disc := 4*a*c - b*b
+	integral := func(v float64) float64 {
+		q := math.Sqrt(math.Max(0, (a*v+b)*v+c))
+		ret := (2*a*v + b) / (4 * a) * q
+		if disc > 0 {
+			ret += disc / (8 * a * sqrtA) * math.Log(2*sqrtA*q+2*a*v+b)
+		}
+		return ret
+	}
+	return self.phiMax * (integral(1) - integral(0))
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"Anvil/media"
+	"math"
 )
 
 type Interaction struct {
@@ -25,6 +26,66 @@ func NewInteraction(p Point3, n Normal3, pError, wo Vec3, time float64, med *med
 	return Interaction{p, time, pError, wo, n, med}
 }
 
+// GetMedium is the medium a ray leaving in direction w travels through
+func (i Interaction) GetMedium(w Vec3) *media.Medium {
+	if i.mediumInterface == nil {
+		return nil
+	}
+	if DotV3(w, i.n.ToVec3()) > 0 {
+		return i.mediumInterface.Outside
+	}
+	return i.mediumInterface.Inside
+}
+
+// SpawnRay starts a ray at the interaction that won't hit the surface it is on
+func (i Interaction) SpawnRay(d Vec3) Ray {
+	o := OffsetRayOrigin(i.p, i.pError, i.n, d)
+	return NewRay(o, d, math.Inf(1), i.time, i.GetMedium(d))
+}
+
+// SpawnRayTo is a ray towards p2 that stops just short of it, d is unnormalized so
+// p2 is at t = 1
+func (i Interaction) SpawnRayTo(p2 Point3) Ray {
+	o := OffsetRayOrigin(i.p, i.pError, i.n, p2.SubtractP(i.p))
+	d := p2.SubtractP(o)
+	return NewRay(o, d, 1-ShadowEpsilon, i.time, i.GetMedium(d))
+}
+
+// SpawnRayToInteraction is SpawnRayTo for a target on a surface, both ends are
+// offset so the ray hits neither surface
+func (i Interaction) SpawnRayToInteraction(it Interaction) Ray {
+	o := OffsetRayOrigin(i.p, i.pError, i.n, it.p.SubtractP(i.p))
+	target := OffsetRayOrigin(it.p, it.pError, it.n, o.SubtractP(it.p))
+	d := target.SubtractP(o)
+	return NewRay(o, d, 1-ShadowEpsilon, i.time, i.GetMedium(d))
+}
+
+/*
+OffsetRayOrigin moves p along the normal to the side w points to, far enough to
+be past the error bounds of p. The offset is the distance of the corner of the
+error box along the normal, then rounded away from p so the addition can't land
+back inside.
+*/
+func OffsetRayOrigin(p Point3, pError Vec3, n Normal3, w Vec3) Point3 {
+	nv := n.ToVec3()
+	d := DotV3(AbsV3(nv), pError)
+	offset := nv.Multiply(d)
+	if DotV3(w, nv) < 0 {
+		offset = offset.Inverse()
+	}
+	po := p.AddV(offset)
+	round := func(v, off float64) float64 {
+		switch {
+		case off > 0:
+			return NextFloatUp(v)
+		case off < 0:
+			return NextFloatDown(v)
+		}
+		return v
+	}
+	return Point3{round(po.X, offset.X), round(po.Y, offset.Y), round(po.Z, offset.Z)}
+}
+
 type SurfaceInteraction struct {
 	inter      Interaction
 	uv         Point2
@@ -54,13 +115,19 @@ func NewSurfaceInteraction(
 	}{normal, dndu, dndv, dpdu, dpdv}
 
 	if shape != nil && Xor(shape.ReverseOrientation, shape.TransformSwapsHandedness) {
-		normal = normal.Multiply(-1)
+		interaction.n = interaction.n.Multiply(-1)
 		shading.n = shading.n.Multiply(-1)
 	}
 	return SurfaceInteraction{interaction, uv, dpdu, dpdv, dndu, dndv, shape, nil, shading}
 }
 
-func (si SurfaceInteraction) SetShadingGeometry(dpdus, dpdvs Vec3,
+// Interaction is the geometric part of the hit, rays leaving the surface are
+// spawned from it
+func (si SurfaceInteraction) Interaction() Interaction {
+	return si.inter
+}
+
+func (si *SurfaceInteraction) SetShadingGeometry(dpdus, dpdvs Vec3,
 	dndus, dndvs Normal3,
 	orientationIsAuthorative bool) {
 	si.shading.n = NormalFromVec3(CrossV3(dpdus, dpdvs)).Normalize()
@@ -1,5 +1,7 @@
 package core
 
+// Material is a material type and its parameters as given in the scene
 type Material struct {
-	Desc string
+	Desc   string
+	Params ParamSet
 }
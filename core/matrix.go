@@ -1,5 +1,7 @@
 package core
 
+import "math"
+
 func inRange(i, j int) bool {
 	return i < 4 && j < 4
 }
@@ -45,7 +47,7 @@ func (m Matrix4x4f) Get(i, j int) float64 {
 	return m[i][j]
 }
 
-func (m Matrix4x4f) Set(i, j int, f float64) {
+func (m *Matrix4x4f) Set(i, j int, f float64) {
 	if inRange(i, j) {
 		m[i][j] = f
 	}
@@ -73,140 +75,72 @@ func (m Matrix4x4f) Det() float64 {
 		m[0][1]*m[1][0]*m[2][2]*m[3][3] + m[0][0]*m[1][1]*m[2][2]*m[3][3]
 }
 
+// Inverse uses Gauss-Jordan elimination with full pivoting, returns false if the
+// matrix is singular
 func (m Matrix4x4f) Inverse() (bool, Matrix4x4f) {
-	var inv [16]float64
-	var det float64
-	var ret Matrix4x4f
+	var indxc, indxr [4]int
+	ipiv := [4]int{0, 0, 0, 0}
+	minv := m
 
-	inv[0] = m[1][0]*m[2][1]*m[3][3] -
-		m[1][0]*m[2][3]*m[3][2] -
-		m[2][1]*m[1][2]*m[3][3] +
-		m[2][1]*m[1][3]*m[3][2] +
-		m[3][1]*m[1][2]*m[2][3] -
-		m[3][1]*m[1][3]*m[2][1]
-
-	inv[1] = -m[0][1]*m[2][1]*m[3][3] +
-		m[0][1]*m[2][3]*m[3][2] +
-		m[2][1]*m[0][2]*m[3][3] -
-		m[2][1]*m[0][3]*m[3][2] -
-		m[3][1]*m[0][2]*m[2][3] +
-		m[3][1]*m[0][3]*m[2][1]
-
-	inv[2] = m[0][1]*m[1][2]*m[3][3] -
-		m[0][1]*m[1][3]*m[3][2] -
-		m[1][0]*m[0][2]*m[3][3] +
-		m[1][0]*m[0][3]*m[3][2] +
-		m[3][1]*m[0][2]*m[1][3] -
-		m[3][1]*m[0][3]*m[1][2]
-
-	inv[3] = -m[0][1]*m[1][2]*m[2][3] +
-		m[0][1]*m[1][3]*m[2][1] +
-		m[1][0]*m[0][2]*m[2][3] -
-		m[1][0]*m[0][3]*m[2][1] -
-		m[2][1]*m[0][2]*m[1][3] +
-		m[2][1]*m[0][3]*m[1][2]
-
-	inv[4] = -m[1][0]*m[2][1]*m[3][3] +
-		m[1][0]*m[2][3]*m[3][2] +
-		m[2][0]*m[1][2]*m[3][3] -
-		m[2][0]*m[1][3]*m[3][2] -
-		m[3][0]*m[1][2]*m[2][3] +
-		m[3][0]*m[1][3]*m[2][1]
-
-	inv[5] = m[0][0]*m[2][1]*m[3][3] -
-		m[0][0]*m[2][3]*m[3][2] -
-		m[2][0]*m[0][2]*m[3][3] +
-		m[2][0]*m[0][3]*m[3][2] +
-		m[3][0]*m[0][2]*m[2][3] -
-		m[3][0]*m[0][3]*m[2][1]
-
-	inv[6] = -m[0][0]*m[1][2]*m[3][3] +
-		m[0][0]*m[1][3]*m[3][2] +
-		m[1][0]*m[0][2]*m[3][3] -
-		m[1][0]*m[0][3]*m[3][2] -
-		m[3][0]*m[0][2]*m[1][3] +
-		m[3][0]*m[0][3]*m[1][2]
-
-	inv[7] = m[0][0]*m[1][2]*m[2][3] -
-		m[0][0]*m[1][3]*m[2][1] -
-		m[1][0]*m[0][2]*m[2][3] +
-		m[1][0]*m[0][3]*m[2][1] +
-		m[2][0]*m[0][2]*m[1][3] -
-		m[2][0]*m[0][3]*m[1][2]
-
-	inv[8] = m[1][0]*m[2][1]*m[3][3] -
-		m[1][0]*m[2][3]*m[3][1] -
-		m[2][0]*m[1][0]*m[3][3] +
-		m[2][0]*m[1][3]*m[3][1] +
-		m[3][0]*m[1][0]*m[2][3] -
-		m[3][0]*m[1][3]*m[2][1]
-
-	inv[9] = -m[0][0]*m[2][1]*m[3][3] +
-		m[0][0]*m[2][3]*m[3][1] +
-		m[2][0]*m[0][1]*m[3][3] -
-		m[2][0]*m[0][3]*m[3][1] -
-		m[3][0]*m[0][1]*m[2][3] +
-		m[3][0]*m[0][3]*m[2][1]
-
-	inv[10] = m[0][0]*m[1][0]*m[3][3] -
-		m[0][0]*m[1][3]*m[3][1] -
-		m[1][0]*m[0][1]*m[3][3] +
-		m[1][0]*m[0][3]*m[3][1] +
-		m[3][0]*m[0][1]*m[1][3] -
-		m[3][0]*m[0][3]*m[1][0]
-
-	inv[11] = -m[0][0]*m[1][0]*m[2][3] +
-		m[0][0]*m[1][3]*m[2][1] +
-		m[1][0]*m[0][1]*m[2][3] -
-		m[1][0]*m[0][3]*m[2][1] -
-		m[2][0]*m[0][1]*m[1][3] +
-		m[2][0]*m[0][3]*m[1][0]
-
-	inv[12] = -m[1][0]*m[2][1]*m[3][2] +
-		m[1][0]*m[2][1]*m[3][1] +
-		m[2][0]*m[1][0]*m[3][2] -
-		m[2][0]*m[1][2]*m[3][1] -
-		m[3][0]*m[1][0]*m[2][1] +
-		m[3][0]*m[1][2]*m[2][1]
-
-	inv[13] = m[0][0]*m[2][1]*m[3][2] -
-		m[0][0]*m[2][1]*m[3][1] -
-		m[2][0]*m[0][1]*m[3][2] +
-		m[2][0]*m[0][2]*m[3][1] +
-		m[3][0]*m[0][1]*m[2][1] -
-		m[3][0]*m[0][2]*m[2][1]
-
-	inv[14] = -m[0][0]*m[1][0]*m[3][2] +
-		m[0][0]*m[1][2]*m[3][1] +
-		m[1][0]*m[0][1]*m[3][2] -
-		m[1][0]*m[0][2]*m[3][1] -
-		m[3][0]*m[0][1]*m[1][2] +
-		m[3][0]*m[0][2]*m[1][0]
-
-	inv[15] = m[0][0]*m[1][0]*m[2][1] -
-		m[0][0]*m[1][2]*m[2][1] -
-		m[1][0]*m[0][1]*m[2][1] +
-		m[1][0]*m[0][2]*m[2][1] +
-		m[2][0]*m[0][1]*m[1][2] -
-		m[2][0]*m[0][2]*m[1][0]
-
-	det = m[0][0]*inv[0] + m[0][1]*inv[4] + m[0][2]*inv[8] + m[0][3]*inv[12]
-
-	if det == 0 {
-		return false, Mat4x4fID
-	}
+	for i := 0; i < 4; i++ {
+		irow, icol := 0, 0
+		big := float64(0)
+		// Choose pivot
+		for j := 0; j < 4; j++ {
+			if ipiv[j] == 1 {
+				continue
+			}
+			for k := 0; k < 4; k++ {
+				if ipiv[k] == 0 {
+					if math.Abs(minv[j][k]) >= big {
+						big = math.Abs(minv[j][k])
+						irow = j
+						icol = k
+					}
+				} else if ipiv[k] > 1 {
+					return false, Mat4x4fID
+				}
+			}
+		}
+		ipiv[icol]++
+		// Swap rows irow and icol for pivot
+		if irow != icol {
+			minv[irow], minv[icol] = minv[icol], minv[irow]
+		}
+		indxr[i] = irow
+		indxc[i] = icol
+		if minv[icol][icol] == 0 {
+			return false, Mat4x4fID
+		}
 
-	det = 1.0 / det
+		// Set m[icol][icol] to one by scaling row icol appropriately
+		pivinv := 1 / minv[icol][icol]
+		minv[icol][icol] = 1
+		for j := 0; j < 4; j++ {
+			minv[icol][j] *= pivinv
+		}
 
-	k := 0
-	for i := 0; i < 4; i++ {
+		// Subtract this row from others to zero out their columns
 		for j := 0; j < 4; j++ {
-			ret[i][j] = inv[k] * det
-			k++
+			if j != icol {
+				save := minv[j][icol]
+				minv[j][icol] = 0
+				for k := 0; k < 4; k++ {
+					minv[j][k] -= minv[icol][k] * save
+				}
+			}
 		}
 	}
 
-	return true, ret
+	// Swap columns to reflect permutation
+	for j := 3; j >= 0; j-- {
+		if indxr[j] != indxc[j] {
+			for k := 0; k < 4; k++ {
+				minv[k][indxr[j]], minv[k][indxc[j]] = minv[k][indxc[j]], minv[k][indxr[j]]
+			}
+		}
+	}
+	return true, minv
 }
 
 func MulMat4x4f(m0, m1 *Matrix4x4f) Matrix4x4f {
@@ -0,0 +1,101 @@
+package core
+
+import "math"
+
+// Paraboloid is z = zMax * (x^2 + y^2) / radius^2 clipped to [zMin, zMax]
+type Paraboloid struct {
+	shape                      ShapeData
+	radius, zMin, zMax, phiMax float64
+}
+
+func NewParaboloid(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	radius, zMin, zMax, phiMax float64) Paraboloid {
+	return Paraboloid{
+		NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Paraboloid"),
+		radius, math.Min(zMin, zMax), math.Max(zMin, zMax), phiMax}
+}
+
+func (self Paraboloid) ObjectBound() Bounds3 {
+	r := self.radius
+	return NewBounds3(Point3{-r, -r, self.zMin}, Point3{r, r, self.zMax})
+}
+func (self Paraboloid) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
+func (self Paraboloid) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	// Transform ray to object space
+	ray, oErr, dErr := self.shape.WorldToObject.ApplyRE(r)
+
+	// Compute quadratic paraboloid coefficients
+	ox, oy, oz, dx, dy, dz := rayEFloats(ray, oErr, dErr)
+	radius := NewEFloat(self.radius, 0)
+	k := NewEFloat(self.zMax, 0).Divide(radius.Multiply(radius))
+	a := k.Multiply(dx.Multiply(dx).Add(dy.Multiply(dy)))
+	b := k.Multiply(dx.Multiply(ox).Add(dy.Multiply(oy))).Scale(2).Subtract(dz)
+	c := k.Multiply(ox.Multiply(ox).Add(oy.Multiply(oy))).Subtract(oz)
+
+	// Solve for t values
+	ret, t0, t1 := QuadraticE(a, b, c)
+	if !ret || t0.UpperBound() > ray.tMax || t1.LowerBound() <= 0 {
+		return false, 0, SurfaceInteraction{}
+	}
+	tShapeHit := t0
+	if tShapeHit.LowerBound() <= 0 {
+		tShapeHit = t1
+		if tShapeHit.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Compute paraboloid hit position and phi
+	getPosAndPhi := func(tsh float64) (Point3, float64) {
+		p := ray.GetPointForT(tsh)
+		phi := math.Atan2(p.Y, p.X)
+		if phi < 0 {
+			phi += 2 * math.Pi
+		}
+		return p, phi
+	}
+	pHit, phi := getPosAndPhi(tShapeHit.Float64())
+
+	// Test paraboloid intersection against clipping parameters
+	if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+		if tShapeHit == t1 || t1.UpperBound() > ray.tMax {
+			return false, 0, SurfaceInteraction{}
+		}
+		tShapeHit = t1
+		pHit, phi = getPosAndPhi(tShapeHit.Float64())
+		if pHit.Z < self.zMin || pHit.Z > self.zMax || phi > self.phiMax {
+			return false, 0, SurfaceInteraction{}
+		}
+	}
+
+	// Find parametric representation of paraboloid hit
+	u := phi / self.phiMax
+	v := (pHit.Z - self.zMin) / (self.zMax - self.zMin)
+	dz21 := self.zMax - self.zMin
+	dpdu := Vec3{-self.phiMax * pHit.Y, self.phiMax * pHit.X, 0}
+	dpdv := Vec3{pHit.X / (2 * pHit.Z), pHit.Y / (2 * pHit.Z), 1}.Multiply(dz21)
+
+	d2Pduu := Vec3{pHit.X, pHit.Y, 0}.Multiply(-self.phiMax * self.phiMax)
+	d2Pduv := Vec3{-pHit.Y / (2 * pHit.Z), pHit.X / (2 * pHit.Z), 0}.Multiply(dz21 * self.phiMax)
+	d2Pdvv := Vec3{pHit.X / (4 * pHit.Z * pHit.Z), pHit.Y / (4 * pHit.Z * pHit.Z), 0}.Multiply(-dz21 * dz21)
+	dndu, dndv := weingarten(dpdu, dpdv, d2Pduu, d2Pduv, d2Pdvv)
+
+	// Compute error bounds for the intersection point
+	pError := hitError(ox, oy, oz, dx, dy, dz, tShapeHit)
+
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv,
+		dndu, dndv, &self.shape)
+	si = self.shape.ObjectToWorld.ApplySI(si)
+	return true, tShapeHit.Float64(), si
+}
+func (self Paraboloid) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	return intersectP(self, ray, testAlphaTexture)
+}
+func (self Paraboloid) Area() float64 {
+	radius2 := self.radius * self.radius
+	k := 4 * self.zMax / radius2
+	return (radius2 * radius2 * self.phiMax / (12 * self.zMax * self.zMax)) *
+		(math.Pow(k*self.zMax+1, 1.5) - math.Pow(k*self.zMin+1, 1.5))
+}
@@ -0,0 +1,261 @@
+package core
+
+// ParamSetItem is a single named, typed parameter from a scene description such
+// as "float radius" [1]. Numeric payloads (integers, points, vectors, normals and
+// spectra) are all stored flattened in floats, the Type says how to read them back
+type ParamSetItem struct {
+	Name, Type string
+	floats     []float64
+	strings    []string
+	bools      []bool
+	lookedUp   bool
+}
+
+// ParamSet is the list of parameters handed to a directive, lookups mark items as
+// used so that misspelled or unsupported parameters can be reported afterwards
+type ParamSet struct {
+	items []*ParamSetItem
+}
+
+func NewParamSet() ParamSet {
+	return ParamSet{}
+}
+
+// replaces any existing parameter with the same name
+func (ps *ParamSet) add(item *ParamSetItem) {
+	for i, it := range ps.items {
+		if it.Name == item.Name {
+			ps.items[i] = item
+			return
+		}
+	}
+	ps.items = append(ps.items, item)
+}
+
+func (ps *ParamSet) AddFloats(name, typ string, v []float64) {
+	ps.add(&ParamSetItem{Name: name, Type: typ, floats: v})
+}
+
+func (ps *ParamSet) AddStrings(name, typ string, v []string) {
+	ps.add(&ParamSetItem{Name: name, Type: typ, strings: v})
+}
+
+func (ps *ParamSet) AddBools(name string, v []bool) {
+	ps.add(&ParamSetItem{Name: name, Type: "bool", bools: v})
+}
+
+func (ps *ParamSet) Erase(name string) bool {
+	for i, it := range ps.items {
+		if it.Name == name {
+			ps.items = append(ps.items[:i], ps.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (ps *ParamSet) Items() []*ParamSetItem {
+	return ps.items
+}
+
+// find returns the item called name if it has one of the given types
+func (ps *ParamSet) find(name string, types ...string) *ParamSetItem {
+	for _, it := range ps.items {
+		if it.Name != name {
+			continue
+		}
+		for _, t := range types {
+			if it.Type == t {
+				it.lookedUp = true
+				return it
+			}
+		}
+	}
+	return nil
+}
+
+// pbrt allows a few aliases for the geometric types
+var (
+	point3Types  = []string{"point3", "point"}
+	vec3Types    = []string{"vector3", "vector"}
+	normalTypes  = []string{"normal3", "normal"}
+	point2Types  = []string{"point2"}
+	vec2Types    = []string{"vector2"}
+	spectrumType = []string{"rgb", "color", "spectrum", "xyz", "blackbody"}
+)
+
+func (ps *ParamSet) FindOneFloat(name string, d float64) float64 {
+	if it := ps.find(name, "float"); it != nil && len(it.floats) == 1 {
+		return it.floats[0]
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneInt(name string, d int) int {
+	if it := ps.find(name, "integer"); it != nil && len(it.floats) == 1 {
+		return int(it.floats[0])
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneBool(name string, d bool) bool {
+	if it := ps.find(name, "bool"); it != nil && len(it.bools) == 1 {
+		return it.bools[0]
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneString(name string, d string) string {
+	if it := ps.find(name, "string"); it != nil && len(it.strings) == 1 {
+		return it.strings[0]
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOnePoint3(name string, d Point3) Point3 {
+	if it := ps.find(name, point3Types...); it != nil && len(it.floats) == 3 {
+		return Point3{it.floats[0], it.floats[1], it.floats[2]}
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneVec3(name string, d Vec3) Vec3 {
+	if it := ps.find(name, vec3Types...); it != nil && len(it.floats) == 3 {
+		return Vec3{it.floats[0], it.floats[1], it.floats[2]}
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneNormal3(name string, d Normal3) Normal3 {
+	if it := ps.find(name, normalTypes...); it != nil && len(it.floats) == 3 {
+		return Normal3{it.floats[0], it.floats[1], it.floats[2]}
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOnePoint2(name string, d Point2) Point2 {
+	if it := ps.find(name, point2Types...); it != nil && len(it.floats) == 2 {
+		return Point2{it.floats[0], it.floats[1]}
+	}
+	return d
+}
+
+// FindOneSpectrum returns the raw coefficients of a color parameter, an rgb is three
+// floats, sampled spectra are (lambda, value) pairs
+func (ps *ParamSet) FindOneSpectrum(name string, d []float64) []float64 {
+	if it := ps.find(name, spectrumType...); it != nil {
+		return it.floats
+	}
+	return d
+}
+
+func (ps *ParamSet) FindOneTexture(name string) string {
+	if it := ps.find(name, "texture"); it != nil && len(it.strings) == 1 {
+		return it.strings[0]
+	}
+	return ""
+}
+
+func (ps *ParamSet) FindFloat(name string) []float64 {
+	if it := ps.find(name, "float"); it != nil {
+		return it.floats
+	}
+	return nil
+}
+
+func (ps *ParamSet) FindInt(name string) []int {
+	it := ps.find(name, "integer")
+	if it == nil {
+		return nil
+	}
+	ret := make([]int, len(it.floats))
+	for i, f := range it.floats {
+		ret[i] = int(f)
+	}
+	return ret
+}
+
+func (ps *ParamSet) FindBool(name string) []bool {
+	if it := ps.find(name, "bool"); it != nil {
+		return it.bools
+	}
+	return nil
+}
+
+func (ps *ParamSet) FindString(name string) []string {
+	if it := ps.find(name, "string"); it != nil {
+		return it.strings
+	}
+	return nil
+}
+
+func (ps *ParamSet) FindPoint3(name string) []Point3 {
+	it := ps.find(name, point3Types...)
+	if it == nil {
+		return nil
+	}
+	ret := make([]Point3, len(it.floats)/3)
+	for i := range ret {
+		ret[i] = Point3{it.floats[3*i], it.floats[3*i+1], it.floats[3*i+2]}
+	}
+	return ret
+}
+
+func (ps *ParamSet) FindVec3(name string) []Vec3 {
+	it := ps.find(name, vec3Types...)
+	if it == nil {
+		return nil
+	}
+	ret := make([]Vec3, len(it.floats)/3)
+	for i := range ret {
+		ret[i] = Vec3{it.floats[3*i], it.floats[3*i+1], it.floats[3*i+2]}
+	}
+	return ret
+}
+
+func (ps *ParamSet) FindNormal3(name string) []Normal3 {
+	it := ps.find(name, normalTypes...)
+	if it == nil {
+		return nil
+	}
+	ret := make([]Normal3, len(it.floats)/3)
+	for i := range ret {
+		ret[i] = Normal3{it.floats[3*i], it.floats[3*i+1], it.floats[3*i+2]}
+	}
+	return ret
+}
+
+func (ps *ParamSet) FindPoint2(name string) []Point2 {
+	it := ps.find(name, point2Types...)
+	if it == nil {
+		return nil
+	}
+	ret := make([]Point2, len(it.floats)/2)
+	for i := range ret {
+		ret[i] = Point2{it.floats[2*i], it.floats[2*i+1]}
+	}
+	return ret
+}
+
+func (ps *ParamSet) FindVec2(name string) []Vec2 {
+	it := ps.find(name, vec2Types...)
+	if it == nil {
+		return nil
+	}
+	ret := make([]Vec2, len(it.floats)/2)
+	for i := range ret {
+		ret[i] = Vec2{it.floats[2*i], it.floats[2*i+1]}
+	}
+	return ret
+}
+
+// Unused returns the names of all parameters that were never looked up
+func (ps *ParamSet) Unused() []string {
+	var ret []string
+	for _, it := range ps.items {
+		if !it.lookedUp {
+			ret = append(ret, it.Type+" "+it.Name)
+		}
+	}
+	return ret
+}
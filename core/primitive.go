@@ -1,8 +1,13 @@
 package core
 
+import "Anvil/media"
+
 type Primitive interface {
 	WorldBound() Bounds3
-	Intersect(Ray) (bool, SurfaceInteraction)
+	// on a hit the ray's tMax is updated to the distance of the hit
+	Intersect(*Ray) (bool, SurfaceInteraction)
+	// IntersectP only checks for an intersection, used for shadow rays
+	IntersectP(Ray) bool
 	GetAreaLight() *AreaLight
 	GetMaterial() *Material
 	//TODO: ComputeScatteringFunctions
@@ -10,34 +15,86 @@ type Primitive interface {
 
 // Represents a single shape in a scene
 type GeometricPrimitive struct {
-	shape     ShapeInter
-	material  *Material
-	areaLight *AreaLight
-	//TODO:  MediumInterface
+	shape           ShapeInter
+	material        *Material
+	areaLight       *AreaLight
+	mediumInterface media.MediumInterface
 }
 
-func NewGeometricPrimitive(shape ShapeInter, material *Material, areaLight *AreaLight) GeometricPrimitive {
-	return GeometricPrimitive{shape, material, areaLight}
+func NewGeometricPrimitive(shape ShapeInter, material *Material, areaLight *AreaLight,
+	mediumInterface media.MediumInterface) GeometricPrimitive {
+	return GeometricPrimitive{shape, material, areaLight, mediumInterface}
 }
 
 func (self GeometricPrimitive) WorldBound() Bounds3 {
-	return self.shape.ObjectBound()
+	return self.shape.WorldBound()
 }
 
-func (self GeometricPrimitive) Intersect(r Ray) (bool, SurfaceInteraction) {
-	b, tHit, si := self.shape.Intersect(r, false)
+func (self GeometricPrimitive) Intersect(r *Ray) (bool, SurfaceInteraction) {
+	b, tHit, si := self.shape.Intersect(*r, false)
 	if !b {
 		return false, SurfaceInteraction{}
 	}
 	r.tMax = tHit
 	si.primitive = self
-	// TODO: init mediumInterface
+	// only surfaces that separate two different media override the ray's medium
+	if self.mediumInterface.IsMediumTransition() {
+		si.inter.mediumInterface = &self.mediumInterface
+	} else {
+		mi := media.NewMediumInterface(r.medium, r.medium)
+		si.inter.mediumInterface = &mi
+	}
 	return true, si
 }
 
+func (self GeometricPrimitive) IntersectP(r Ray) bool {
+	return self.shape.IntersectP(r, false)
+}
+
 func (self GeometricPrimitive) GetAreaLight() *AreaLight {
 	return self.areaLight
 }
 func (self GeometricPrimitive) GetMaterial() *Material {
 	return self.material
 }
+
+// TransformedPrimitive places a shared primitive (usually an aggregate) in the
+// scene with its own transform, used for object instancing and for moving shapes
+type TransformedPrimitive struct {
+	primitive        Primitive
+	primitiveToWorld *AnimatedTransform
+}
+
+func NewTransformedPrimitive(primitive Primitive, primitiveToWorld *AnimatedTransform) TransformedPrimitive {
+	return TransformedPrimitive{primitive, primitiveToWorld}
+}
+
+func (self TransformedPrimitive) WorldBound() Bounds3 {
+	return self.primitiveToWorld.MotionBounds(self.primitive.WorldBound())
+}
+
+func (self TransformedPrimitive) Intersect(r *Ray) (bool, SurfaceInteraction) {
+	// Compute ray after transformation by primitiveToWorld at the ray's time
+	primToWorld := self.primitiveToWorld.Interpolate(r.Time)
+	ray := primToWorld.Inverse().ApplyR(*r)
+	b, si := self.primitive.Intersect(&ray)
+	if !b {
+		return false, SurfaceInteraction{}
+	}
+	r.tMax = ray.tMax
+	// Transform instance's intersection data to world space
+	return true, primToWorld.ApplySI(si)
+}
+
+func (self TransformedPrimitive) IntersectP(r Ray) bool {
+	primToWorld := self.primitiveToWorld.Interpolate(r.Time)
+	return self.primitive.IntersectP(primToWorld.Inverse().ApplyR(r))
+}
+
+// the material and area light come from the primitive that was hit, not the instance
+func (self TransformedPrimitive) GetAreaLight() *AreaLight {
+	return nil
+}
+func (self TransformedPrimitive) GetMaterial() *Material {
+	return nil
+}
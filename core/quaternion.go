@@ -0,0 +1,104 @@
+package core
+
+import "math"
+
+// Quaternion represents rotations for interpolation, v is the imaginary part
+type Quaternion struct {
+	V Vec3
+	W float64
+}
+
+func NewQuaternion() Quaternion {
+	return Quaternion{Vec3{}, 1}
+}
+
+// NewQuaternionFromTransform extracts the rotation of a transform that is a pure
+// rotation
+func NewQuaternionFromTransform(t Transform) Quaternion {
+	m := t.m
+	var q Quaternion
+	trace := m[0][0] + m[1][1] + m[2][2]
+	if trace > 0 {
+		// Compute w from matrix trace, then xyz
+		s := math.Sqrt(trace + 1)
+		q.W = s / 2
+		s = 0.5 / s
+		q.V = Vec3{(m[2][1] - m[1][2]) * s, (m[0][2] - m[2][0]) * s, (m[1][0] - m[0][1]) * s}
+		return q
+	}
+
+	// Compute largest of x, y or z, then remaining components
+	next := [3]int{1, 2, 0}
+	var qv [3]float64
+	i := 0
+	if m[1][1] > m[0][0] {
+		i = 1
+	}
+	if m[2][2] > m[i][i] {
+		i = 2
+	}
+	j := next[i]
+	k := next[j]
+	s := math.Sqrt((m[i][i] - (m[j][j] + m[k][k])) + 1)
+	qv[i] = s * 0.5
+	if s != 0 {
+		s = 0.5 / s
+	}
+	q.W = (m[k][j] - m[j][k]) * s
+	qv[j] = (m[j][i] + m[i][j]) * s
+	qv[k] = (m[k][i] + m[i][k]) * s
+	q.V = Vec3{qv[0], qv[1], qv[2]}
+	return q
+}
+
+func (q Quaternion) Add(q2 Quaternion) Quaternion {
+	return Quaternion{q.V.Add(q2.V), q.W + q2.W}
+}
+
+func (q Quaternion) Subtract(q2 Quaternion) Quaternion {
+	return Quaternion{q.V.Subtract(q2.V), q.W - q2.W}
+}
+
+func (q Quaternion) Multiply(f float64) Quaternion {
+	return Quaternion{q.V.Multiply(f), q.W * f}
+}
+
+func (q Quaternion) Divide(f float64) Quaternion {
+	return Quaternion{q.V.Divide(f), q.W / f}
+}
+
+func (q Quaternion) Normalize() Quaternion {
+	return q.Divide(math.Sqrt(DotQ(q, q)))
+}
+
+// ToTransform is the rotation matrix of a unit quaternion
+func (q Quaternion) ToTransform() Transform {
+	xx, yy, zz := q.V.X*q.V.X, q.V.Y*q.V.Y, q.V.Z*q.V.Z
+	xy, xz, yz := q.V.X*q.V.Y, q.V.X*q.V.Z, q.V.Y*q.V.Z
+	wx, wy, wz := q.V.X*q.W, q.V.Y*q.W, q.V.Z*q.W
+
+	m := NewMat4x4f(
+		1-2*(yy+zz), 2*(xy+wz), 2*(xz-wy), 0,
+		2*(xy-wz), 1-2*(xx+zz), 2*(yz+wx), 0,
+		2*(xz+wy), 2*(yz-wx), 1-2*(xx+yy), 0,
+		0, 0, 0, 1)
+	// the matrix above is the inverse rotation, its transpose is the rotation
+	return Transform{m.Transpose(), m}
+}
+
+func DotQ(q1, q2 Quaternion) float64 {
+	return DotV3(q1.V, q2.V) + q1.W*q2.W
+}
+
+// Slerp interpolates along the great arc between two unit quaternions, falling
+// back to a normalized lerp when they are almost parallel
+func Slerp(t float64, q1, q2 Quaternion) Quaternion {
+	cosTheta := DotQ(q1, q2)
+	if cosTheta > 0.9995 {
+		return q1.Multiply(1 - t).Add(q2.Multiply(t)).Normalize()
+	}
+	theta := math.Acos(Clamp(cosTheta, -1, 1))
+	thetap := theta * t
+	qperp := q2.Subtract(q1.Multiply(cosTheta)).Normalize()
+	return q1.Multiply(math.Cos(thetap)).Add(qperp.Multiply(math.Sin(thetap)))
+}
@@ -16,6 +16,11 @@ func (r Ray) GetPointForT(t float64) Point3 {
 	return r.Orig.AddV(r.Dir.Multiply(t)) // return o + t*d
 }
 
+// TMax is how far along the ray hits are looked for, it shrinks as they are found
+func (r Ray) TMax() float64 {
+	return r.tMax
+}
+
 func NewEmptyRay() Ray {
 	return Ray{tMax: math.Inf(1), Time: 0.0, medium: nil}
 }
@@ -34,8 +39,8 @@ func NewRay(p Point3, d Vec3, tMax, time float64, medium *media.Medium) Ray {
 type RayDifferential struct {
 	R                  *Ray
 	HasDifferentials   bool
-	rxOrigin, ryOrigin Point3
-	rxDir, ryDir       Vec3
+	RxOrigin, RyOrigin Point3
+	RxDir, RyDir       Vec3
 }
 
 func NewEmptyRayDiff() RayDifferential {
@@ -54,10 +59,10 @@ func (r *RayDifferential) ScaleRayDifferentials(s float64) {
 	o := r.R.Orig
 	d := r.R.Dir
 
-	r.rxOrigin = o.AddV(r.rxOrigin.SubtractP(o).Multiply(s))
-	r.ryOrigin = o.AddV(r.ryOrigin.SubtractP(o).Multiply(s))
-	r.rxDir = d.Add(r.rxDir.Subtract(d).Multiply(s))
-	r.ryDir = d.Add(r.ryDir.Subtract(d).Multiply(s))
+	r.RxOrigin = o.AddV(r.RxOrigin.SubtractP(o).Multiply(s))
+	r.RyOrigin = o.AddV(r.RyOrigin.SubtractP(o).Multiply(s))
+	r.RxDir = d.Add(r.RxDir.Subtract(d).Multiply(s))
+	r.RyDir = d.Add(r.RyDir.Subtract(d).Multiply(s))
 }
 
 func NewRayDifferential(r *Ray) RayDifferential {
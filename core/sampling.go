@@ -0,0 +1,26 @@
+package core
+
+import "math"
+
+// ConcentricSampleDisk maps a point of the unit square to the unit disk, keeping
+// the relative areas of regions so stratified samples stay stratified
+func ConcentricSampleDisk(u Point2) Point2 {
+	// Map uniform random numbers to [-1, 1]^2
+	uOffset := Point2{2*u.X - 1, 2*u.Y - 1}
+
+	// Handle degeneracy at the origin
+	if uOffset.X == 0 && uOffset.Y == 0 {
+		return Point2{}
+	}
+
+	// Apply concentric mapping to point
+	var r, theta float64
+	if math.Abs(uOffset.X) > math.Abs(uOffset.Y) {
+		r = uOffset.X
+		theta = (math.Pi / 4) * (uOffset.Y / uOffset.X)
+	} else {
+		r = uOffset.Y
+		theta = math.Pi/2 - (math.Pi/4)*(uOffset.X/uOffset.Y)
+	}
+	return Point2{r * math.Cos(theta), r * math.Sin(theta)}
+}
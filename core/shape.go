@@ -4,6 +4,7 @@ import "math"
 
 type ShapeInter interface {
 	ObjectBound() Bounds3
+	WorldBound() Bounds3
 	// ray should be in world space, shape responsible to translate to object space if needed
 	// testAlphaTexture tests for textures that 'cut away' parts of the shape surface
 	Intersect(ray Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction)
@@ -20,6 +21,38 @@ func intersectP(si ShapeInter, ray Ray, testAlphaTexture bool) bool {
 	return b
 }
 
+// weingarten gives the change in normal along u and v from the first and second
+// partial derivatives of a parametric surface
+func weingarten(dpdu, dpdv, d2Pduu, d2Pduv, d2Pdvv Vec3) (Normal3, Normal3) {
+	// Coefficients of the first and second fundamental forms
+	E := DotV3(dpdu, dpdu)
+	F := DotV3(dpdu, dpdv)
+	G := DotV3(dpdv, dpdv)
+	N := CrossV3(dpdu, dpdv).Normalize()
+	e := DotV3(N, d2Pduu)
+	f := DotV3(N, d2Pduv)
+	g := DotV3(N, d2Pdvv)
+
+	invEGF2 := 1 / (E*G - F*F)
+	dndu := NormalFromVec3(dpdu.Multiply((f*F - e*G) * invEGF2).Add(dpdv.Multiply((e*F - f*E) * invEGF2)))
+	dndv := NormalFromVec3(dpdu.Multiply((g*F - f*G) * invEGF2).Add(dpdv.Multiply((f*F - g*E) * invEGF2)))
+	return dndu, dndv
+}
+
+// rayEFloats gives an object space ray's origin and direction with their errors
+func rayEFloats(ray Ray, oErr, dErr Vec3) (ox, oy, oz, dx, dy, dz EFloat) {
+	return NewEFloat(ray.Orig.X, oErr.X), NewEFloat(ray.Orig.Y, oErr.Y), NewEFloat(ray.Orig.Z, oErr.Z),
+		NewEFloat(ray.Dir.X, dErr.X), NewEFloat(ray.Dir.Y, dErr.Y), NewEFloat(ray.Dir.Z, dErr.Z)
+}
+
+// hitError bounds the error of a hit point computed as o + t*d
+func hitError(ox, oy, oz, dx, dy, dz, t EFloat) Vec3 {
+	px := ox.Add(t.Multiply(dx))
+	py := oy.Add(t.Multiply(dy))
+	pz := oz.Add(t.Multiply(dz))
+	return Vec3{px.AbsoluteError(), py.AbsoluteError(), pz.AbsoluteError()}
+}
+
 type ShapeData struct {
 	Desc                                         string
 	ObjectToWorld, WorldToObject                 *Transform
@@ -43,10 +76,10 @@ func NewSphere(objectToWorld, worldToObject *Transform, reverseOrientation bool,
 	return Sphere{
 		NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Sphere"),
 		radius,
+		Clamp(math.Min(zMin, zMax), -radius, radius),
 		Clamp(math.Max(zMin, zMax), -radius, radius),
-		Clamp(math.Max(zMin, zMax), -radius, radius),
-		math.Acos(Clamp(zMin/radius, -1, 1)),
-		math.Asin(Clamp(zMax/radius, -1, 1)),
+		math.Acos(Clamp(math.Min(zMin, zMax)/radius, -1, 1)),
+		math.Acos(Clamp(math.Max(zMin, zMax)/radius, -1, 1)),
 		phiMax}
 }
 
@@ -54,33 +87,35 @@ func (self Sphere) ObjectBound() Bounds3 {
 	r := self.radius
 	return NewBounds3(Point3{-r, -r, self.zMin}, Point3{r, r, self.zMax})
 }
+func (self Sphere) WorldBound() Bounds3 {
+	return WorldBound(self.shape, self)
+}
 func (self Sphere) Intersect(r Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
 	var phi float64
 	var pHit Point3
 
 	// Transform ray to object space
-	ray := self.shape.WorldToObject.ApplyR(r)
+	ray, oErr, dErr := self.shape.WorldToObject.ApplyRE(r)
 
 	// Compute quadratic sphere coefficients
-	dx, dy, dz := ray.Dir.X, ray.Dir.Y, ray.Dir.Z
-	ox, oy, oz := ray.Orig.X, ray.Orig.Y, ray.Orig.Z
+	ox, oy, oz, dx, dy, dz := rayEFloats(ray, oErr, dErr)
 	radius := self.radius
+	eRadius := NewEFloat(radius, 0)
 
-	a := dx*dx + dy*dy + dz*dz
-	b := 2 * (dx*ox + dy*oy + dz*oz)
-	c := ox*ox + oy*oy + oz*oz - radius*radius
+	a := dx.Multiply(dx).Add(dy.Multiply(dy)).Add(dz.Multiply(dz))
+	b := dx.Multiply(ox).Add(dy.Multiply(oy)).Add(dz.Multiply(oz)).Scale(2)
+	c := ox.Multiply(ox).Add(oy.Multiply(oy)).Add(oz.Multiply(oz)).Subtract(eRadius.Multiply(eRadius))
 
 	// Solve for t values
-	var t0, t1 float64
-	ret, t0, t1 := Quadratic(a, b, c)
-	if !ret || t0 > ray.tMax || t1 <= 0 {
+	ret, t0, t1 := QuadraticE(a, b, c)
+	if !ret || t0.UpperBound() > ray.tMax || t1.LowerBound() <= 0 {
 		return false, 0, SurfaceInteraction{}
 	}
 
 	tShapeHit := t0
-	if tShapeHit <= 0 {
+	if tShapeHit.LowerBound() <= 0 {
 		tShapeHit = t1
-		if tShapeHit >= ray.tMax {
+		if tShapeHit.UpperBound() > ray.tMax {
 			return false, 0, SurfaceInteraction{}
 		}
 	}
@@ -88,18 +123,20 @@ func (self Sphere) Intersect(r Ray, testAlphaTexture bool) (bool, float64, Surfa
 	// Compute sphere hit position and phi
 	getPosAndPhi := func(tsh float64) (Point3, float64) {
 		p := ray.GetPointForT(tsh)
-		// TODO: refine sphere intersection point
+		// Refine sphere intersection point by projecting it back onto the surface,
+		// at the poles phi is undefined so nudge it off the z axis
+		p = p.Multiply(radius / DistanceP3(p, Point3{}))
 		if p.X == 0 && p.Y == 0 {
-			p.Z = 1e-5 * radius
+			p.X = 1e-5 * radius
 		}
 		thisPhi := math.Atan2(p.Y, p.X)
-		if phi < 0 {
-			phi += 2 * math.Pi
+		if thisPhi < 0 {
+			thisPhi += 2 * math.Pi
 		}
 		return p, thisPhi
 	}
 
-	pHit, phi = getPosAndPhi(tShapeHit)
+	pHit, phi = getPosAndPhi(tShapeHit.Float64())
 
 	// Test sphere intersection against clipping parameters, careful that z range
 	// doesnt lie inside of sphere
@@ -107,11 +144,11 @@ func (self Sphere) Intersect(r Ray, testAlphaTexture bool) (bool, float64, Surfa
 		(self.zMax < radius && pHit.Z > self.zMax) ||
 		phi > self.phiMax {
 
-		if tShapeHit == t1 || t1 > ray.tMax {
+		if tShapeHit == t1 || t1.UpperBound() > ray.tMax {
 			return false, 0, SurfaceInteraction{}
 		}
 		tShapeHit = t1
-		pHit, phi = getPosAndPhi(tShapeHit)
+		pHit, phi = getPosAndPhi(tShapeHit.Float64())
 		if (self.zMin > -radius && pHit.Z < self.zMin) ||
 			(self.zMax < radius && pHit.Z > self.zMax) ||
 			phi > self.phiMax {
@@ -134,26 +171,18 @@ func (self Sphere) Intersect(r Ray, testAlphaTexture bool) (bool, float64, Surfa
 	d2Pduv := Vec3{-sinPhi, cosPhi, 0}.Multiply((self.thetaMax - self.thetaMin) * pHit.Z * self.phiMax)
 	d2Pdvv := Vec3{pHit.X, pHit.Y, pHit.Z}.Multiply((self.thetaMax - self.thetaMin) * -(self.thetaMax - self.thetaMin))
 
-	E := DotV3(dpdu, dpdu)
-	F := DotV3(dpdu, dpdv)
-	G := DotV3(dpdv, dpdv)
-	N := CrossV3(dpdu, dpdv).Normalize()
-	e := DotV3(N, d2Pduu)
-	f := DotV3(N, d2Pduv)
-	g := DotV3(N, d2Pdvv)
-
-	invEGF2 := 1 / (E*G - F*F)
-	dndu := NormalFromVec3(dpdu.Multiply((f*F - e*G) * invEGF2).Add(dpdv.Multiply((e*F - f*E) * invEGF2)))
-	dndv := NormalFromVec3(dpdu.Multiply((g*F - f*G) * invEGF2).Add(dpdv.Multiply((f*F - g*E) * invEGF2)))
+	dndu, dndv := weingarten(dpdu, dpdv, d2Pduu, d2Pduv, d2Pdvv)
 
-	// TODO: Compute error bounds for sphere intersection
+	// Compute error bounds for sphere intersection, after reprojection they only
+	// depend on the rounding of the scaling by radius / distance
+	pError := AbsV3(pHit.ToVec()).Multiply(Gamma(5))
 
 	// Initialize surface interaction for parametric information
-	si := NewSurfaceInteraction(pHit, Vec3{}, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv, dndu, dndv, &self.shape)
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, Point2{u, v}, dpdu, dpdv, dndu, dndv, &self.shape)
 	si = self.shape.ObjectToWorld.ApplySI(si)
 
 	// update thit for quadratic intersection
-	return true, tShapeHit, si
+	return true, tShapeHit.Float64(), si
 }
 func (self Sphere) IntersectP(ray Ray, testAlphaTexture bool) bool {
 	return intersectP(self, ray, testAlphaTexture)
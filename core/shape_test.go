@@ -0,0 +1,106 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func newTestSphere(radius, zMin, zMax, phiMaxDeg float64) Sphere {
+	id := NewTransform()
+	return NewSphere(&id, &id, false, radius, zMin, zMax, Radians(phiMaxDeg))
+}
+
+func TestSphereHitsAreOnSurface(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := newTestSphere(1.5, -1.5, 1.5, 360)
+	for i := 0; i < 10000; i++ {
+		o := Point3{X: rng.Float64()*200 - 100, Y: rng.Float64()*200 - 100, Z: rng.Float64()*200 - 100}
+		target := Point3{X: rng.Float64() - 0.5, Y: rng.Float64() - 0.5, Z: rng.Float64() - 0.5}
+		hit, _, si := s.Intersect(NewRay(o, target.SubtractP(o), math.Inf(1), 0, nil), false)
+		if !hit {
+			t.Fatalf("ray from %v towards %v inside the sphere missed", o, target)
+		}
+		// the sphere has to pass through the error box around the hit point
+		p, e := si.inter.p, si.inter.pError
+		var near, far float64
+		for axis := 0; axis < 3; axis++ {
+			lo, hi := p.Get(axis)-e.Get(axis), p.Get(axis)+e.Get(axis)
+			if lo > 0 {
+				near += lo * lo
+			} else if hi < 0 {
+				near += hi * hi
+			}
+			m := math.Max(math.Abs(lo), math.Abs(hi))
+			far += m * m
+		}
+		if math.Sqrt(near) > 1.5 || math.Sqrt(far) < 1.5 {
+			t.Fatalf("hit %v with error %v isn't on the sphere, |p| = %v", p, e, DistanceP3(p, Point3{}))
+		}
+	}
+}
+
+func TestPartialSpherePhiClipping(t *testing.T) {
+	// only the quarter with x, y >= 0 is left
+	s := newTestSphere(1, -1, 1, 90)
+
+	// the ray enters at phi = 150 degrees, which is clipped, and leaves at 30
+	hit, tHit, si := s.Intersect(NewRay(Point3{X: -5, Y: 0.5}, Vec3{X: 1}, math.Inf(1), 0, nil), false)
+	if !hit {
+		t.Fatal("ray through the kept quarter missed")
+	}
+	if want := 5 + math.Sqrt(0.75); math.Abs(tHit-want) > 1e-9 {
+		t.Errorf("t = %v, want the exit at %v", tHit, want)
+	}
+	if u := si.uv.X; math.Abs(u-1.0/3) > 1e-9 {
+		t.Errorf("u = %v, want 1/3", u)
+	}
+
+	// both hits have negative atan2 phi, they must be wrapped to 330 and 210 degrees
+	if s.IntersectP(NewRay(Point3{X: -5, Y: -0.5}, Vec3{X: 1}, math.Inf(1), 0, nil), false) {
+		t.Error("ray through the removed part y < 0 hit")
+	}
+	if s.IntersectP(NewRay(Point3{X: -0.5, Y: -5}, Vec3{Y: 1}, math.Inf(1), 0, nil), false) {
+		t.Error("ray through the removed part x < 0 hit")
+	}
+}
+
+func TestPartialSphereZClipping(t *testing.T) {
+	s := newTestSphere(1, -0.5, 0.5, 360)
+
+	// straight down near the axis only meets the caps, which are cut off
+	if s.IntersectP(NewRay(Point3{X: 0.1, Y: 0.1, Z: 5}, Vec3{Z: -1}, math.Inf(1), 0, nil), false) {
+		t.Error("ray through the open top hit")
+	}
+
+	// steep enough to enter through the open top and hit the band from inside
+	o := Point3{X: -0.3, Z: 5}
+	target := Point3{X: 0.95, Z: 0}
+	hit, _, si := s.Intersect(NewRay(o, target.SubtractP(o), math.Inf(1), 0, nil), false)
+	if !hit {
+		t.Fatal("ray entering through the open top missed the band")
+	}
+	if z := si.inter.p.Z; z < -0.5 || z > 0.5 {
+		t.Errorf("hit at z = %v outside [-0.5, 0.5]", z)
+	}
+	if v := si.uv.Y; v < 0 || v > 1 {
+		t.Errorf("v = %v outside [0, 1]", v)
+	}
+	if want := 2 * math.Pi; math.Abs(s.Area()-want) > 1e-12 {
+		t.Errorf("area = %v, want %v", s.Area(), want)
+	}
+}
+
+func TestSpherePoleHit(t *testing.T) {
+	s := newTestSphere(2, -2, 2, 360)
+	hit, tHit, si := s.Intersect(NewRay(Point3{Z: 5}, Vec3{Z: -1}, math.Inf(1), 0, nil), false)
+	if !hit || math.Abs(tHit-3) > 1e-9 {
+		t.Fatalf("hit = %v at t = %v, want a hit at t = 3", hit, tHit)
+	}
+	if si.inter.p.HasNaN() || si.dpdu.HasNaN() || si.dpdv.HasNaN() || math.IsNaN(si.uv.X) {
+		t.Errorf("NaN in the pole hit: p %v dpdu %v dpdv %v uv %v", si.inter.p, si.dpdu, si.dpdv, si.uv)
+	}
+	if math.Abs(si.inter.p.Z-2) > 1e-9 {
+		t.Errorf("pole hit at %v, want z = 2", si.inter.p)
+	}
+}
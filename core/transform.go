@@ -55,6 +55,32 @@ func (t Transform) ApplyPE(p Point3) (Point3, Vec3) {
 	return ret, err
 }
 
+// ApplyPEWithErr transforms a point that already carries some error, the returned
+// error bounds both the existing error and the error from the transformation
+func (t Transform) ApplyPEWithErr(p Point3, pError Vec3) (Point3, Vec3) {
+	var ret Point3
+	x, y, z := p.X, p.Y, p.Z
+	xp := t.m[0][0]*x + t.m[0][1]*y + t.m[0][2]*z + t.m[0][3]
+	yp := t.m[1][0]*x + t.m[1][1]*y + t.m[1][2]*z + t.m[1][3]
+	zp := t.m[2][0]*x + t.m[2][1]*y + t.m[2][2]*z + t.m[2][3]
+	wp := t.m[3][0]*x + t.m[3][1]*y + t.m[3][2]*z + t.m[3][3]
+
+	g3 := Gamma(3)
+	absErr := func(r int, ex, ey, ez float64) float64 {
+		return (g3+1)*(math.Abs(t.m[r][0])*ex+math.Abs(t.m[r][1])*ey+math.Abs(t.m[r][2])*ez) +
+			g3*(math.Abs(t.m[r][0]*x)+math.Abs(t.m[r][1]*y)+math.Abs(t.m[r][2]*z)+math.Abs(t.m[r][3]))
+	}
+	err := Vec3{absErr(0, pError.X, pError.Y, pError.Z),
+		absErr(1, pError.X, pError.Y, pError.Z),
+		absErr(2, pError.X, pError.Y, pError.Z)}
+	if wp == 1 {
+		ret = Point3{xp, yp, zp}
+	} else {
+		ret = Point3{xp, yp, zp}.Divide(wp)
+	}
+	return ret, err
+}
+
 // ApplyV applies the transform to a vec, we assume homogenous behavior i.e weight of 0
 func (t Transform) ApplyV(v Vec3) Vec3 {
 	x, y, z := v.X, v.Y, v.Z
@@ -82,11 +108,44 @@ func (t Transform) ApplyN(n Normal3) Normal3 {
 		t.mInv[0][2]*x + t.mInv[1][2]*y + t.mInv[2][2]*z}
 }
 
+// ApplyVE transforms a vector and also returns the absolute error of the result
+func (t Transform) ApplyVE(v Vec3) (Vec3, Vec3) {
+	x, y, z := v.X, v.Y, v.Z
+	err := Vec3{math.Abs(t.m[0][0]*x) + math.Abs(t.m[0][1]*y) + math.Abs(t.m[0][2]*z),
+		math.Abs(t.m[1][0]*x) + math.Abs(t.m[1][1]*y) + math.Abs(t.m[1][2]*z),
+		math.Abs(t.m[2][0]*x) + math.Abs(t.m[2][1]*y) + math.Abs(t.m[2][2]*z)}.Multiply(Gamma(3))
+	return t.ApplyV(v), err
+}
+
+// ApplyR transforms a ray, the origin is moved to the edge of its error bounds so
+// that the transformed ray doesn't start on the wrong side of a surface
 func (t Transform) ApplyR(r Ray) Ray {
-	o, _ := t.ApplyPE(r.Orig)
-	d := t.ApplyV(r.Dir)
-	tMax := float64(0)
-	return Ray{o, d, tMax, r.Time, r.medium}
+	ret, _, _ := t.ApplyRE(r)
+	return ret
+}
+
+// ApplyRE is ApplyR that also returns the error of the origin and direction
+func (t Transform) ApplyRE(r Ray) (Ray, Vec3, Vec3) {
+	o, oError := t.ApplyPE(r.Orig)
+	d, dError := t.ApplyVE(r.Dir)
+	tMax := r.tMax
+	lengthSq := d.MagnitudeSq()
+	if lengthSq > 0 {
+		dt := DotV3(Vec3{math.Abs(d.X), math.Abs(d.Y), math.Abs(d.Z)}, oError) / lengthSq
+		o = o.AddV(d.Multiply(dt))
+		tMax -= dt
+	}
+	return Ray{o, d, tMax, r.Time, r.medium}, oError, dError
+}
+
+// ApplyRD transforms a ray and its differentials, the result points at a new ray
+func (t Transform) ApplyRD(rd RayDifferential) RayDifferential {
+	r := t.ApplyR(*rd.R)
+	ret := rd
+	ret.R = &r
+	ret.RxOrigin, ret.RyOrigin = t.ApplyP(rd.RxOrigin), t.ApplyP(rd.RyOrigin)
+	ret.RxDir, ret.RyDir = t.ApplyV(rd.RxDir), t.ApplyV(rd.RyDir)
+	return ret
 }
 
 func (t Transform) ApplyB(b Bounds3) Bounds3 {
@@ -102,15 +161,22 @@ func (t Transform) ApplyB(b Bounds3) Bounds3 {
 }
 
 func (t Transform) ApplySI(si SurfaceInteraction) SurfaceInteraction {
-	ret := SurfaceInteraction{}
+	ret := si
+	ret.inter.p, ret.inter.pError = t.ApplyPEWithErr(si.inter.p, si.inter.pError)
+	ret.inter.n = t.ApplyN(si.inter.n).Normalize()
+	if si.inter.wo != (Vec3{}) {
+		ret.inter.wo = t.ApplyV(si.inter.wo).Normalize()
+	}
 	ret.dndu = t.ApplyN(si.dndu)
 	ret.dndv = t.ApplyN(si.dndv)
 	ret.dpdu = t.ApplyV(si.dpdu)
 	ret.dpdv = t.ApplyV(si.dpdv)
+	ret.shading.n = t.ApplyN(si.shading.n).Normalize()
 	ret.shading.dndu = t.ApplyN(si.shading.dndu)
 	ret.shading.dndv = t.ApplyN(si.shading.dndv)
 	ret.shading.dpdu = t.ApplyV(si.shading.dpdu)
 	ret.shading.dpdv = t.ApplyV(si.shading.dpdv)
+	ret.shading.n = FaceForward(&ret.shading.n, ret.inter.n.ToVec3())
 	return ret
 }
 
@@ -205,7 +271,7 @@ func Scale(x, y, z float64) Transform {
 
 func RotateX(theta float64) Transform {
 	s := math.Sin(Radians(theta))
-	c := math.Sin(Radians(theta))
+	c := math.Cos(Radians(theta))
 	m := NewMat4x4f(1, 0, 0, 0,
 		0, c, -s, 0,
 		0, s, c, 0,
@@ -215,17 +281,17 @@ func RotateX(theta float64) Transform {
 
 func RotateY(theta float64) Transform {
 	s := math.Sin(Radians(theta))
-	c := math.Sin(Radians(theta))
-	m := NewMat4x4f(c, 0, -s, 0,
+	c := math.Cos(Radians(theta))
+	m := NewMat4x4f(c, 0, s, 0,
 		0, 1, 0, 0,
-		s, 0, c, 0,
+		-s, 0, c, 0,
 		0, 0, 0, 1)
 	return NewTransformWithInv(m, m.Transpose())
 }
 
 func RotateZ(theta float64) Transform {
 	s := math.Sin(Radians(theta))
-	c := math.Sin(Radians(theta))
+	c := math.Cos(Radians(theta))
 	m := NewMat4x4f(c, -s, 0, 0,
 		s, c, 0, 0,
 		0, 0, 1, 0,
@@ -236,7 +302,7 @@ func RotateZ(theta float64) Transform {
 func RotateFromAxis(theta float64, axis Vec3) Transform {
 	a := axis.Normalize()
 	s := math.Sin(Radians(theta))
-	c := math.Sin(Radians(theta))
+	c := math.Cos(Radians(theta))
 	var m Matrix4x4f
 	m[0][0] = a.X*a.X + (1-a.X*a.X)*c
 	m[0][1] = a.X*a.Y*(1-c) - a.Z*s
@@ -252,6 +318,8 @@ func RotateFromAxis(theta float64, axis Vec3) Transform {
 	m[2][1] = a.Z*a.Y*(1-c) + a.X*s
 	m[2][2] = a.Z*a.Z + (1-a.Z*a.Z)*c
 	m[2][3] = 0
+
+	m[3][3] = 1
 	return Transform{m, m.Transpose()}
 }
 
@@ -287,6 +355,23 @@ func LookAt(pos, look Point3, up Vec3) Transform {
 	return Transform{inv, cameraToWorld}
 }
 
+// Perspective projects camera space onto the z=1 plane, scaled so the field of view
+// fov (in degrees) covers [-1, 1], z is mapped from [n, f] to [0, 1]
+func Perspective(fov, n, f float64) Transform {
+	persp := NewMat4x4f(1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, f/(f-n), -f*n/(f-n),
+		0, 0, 1, 0)
+	invTanAng := 1 / math.Tan(Radians(fov)/2)
+	return ConcatTransforms(Scale(invTanAng, invTanAng, 1), NewTransformFromMat(persp))
+}
+
+// Orthographic keeps x and y and maps z from [zNear, zFar] to [0, 1]
+func Orthographic(zNear, zFar float64) Transform {
+	return ConcatTransforms(Scale(1, 1, 1/(zFar-zNear)), Translate(Vec3{0, 0, -zNear}))
+}
+
+// ConcatTransforms returns t0*t1, the inverse of a product is the product of the inverses in reverse order
 func ConcatTransforms(t0, t1 Transform) Transform {
-	return Transform{MulMat4x4f(&t0.m, &t1.m), MulMat4x4f(&t0.mInv, &t1.mInv)}
+	return Transform{MulMat4x4f(&t0.m, &t1.m), MulMat4x4f(&t1.mInv, &t0.mInv)}
 }
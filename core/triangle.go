@@ -0,0 +1,293 @@
+package core
+
+import "math"
+
+// TriangleMesh holds the vertex data shared by the triangles of a mesh. Positions,
+// normals and tangents are transformed to world space once when the mesh is made
+// so the triangles don't have to transform rays
+type TriangleMesh struct {
+	nTriangles, nVertices int
+	// three per triangle
+	vertexIndices []int
+	p             []Point3
+	// optional per vertex shading normals, tangents and texture coordinates, nil
+	// if the mesh doesn't have them
+	n  []Normal3
+	s  []Vec3
+	uv []Point2
+}
+
+func NewTriangleMesh(objectToWorld *Transform, vertexIndices []int, p []Point3, s []Vec3,
+	n []Normal3, uv []Point2) *TriangleMesh {
+	mesh := &TriangleMesh{
+		nTriangles:    len(vertexIndices) / 3,
+		nVertices:     len(p),
+		vertexIndices: append([]int(nil), vertexIndices...),
+		p:             make([]Point3, len(p)),
+	}
+	for i := range p {
+		mesh.p[i] = objectToWorld.ApplyP(p[i])
+	}
+	if len(uv) > 0 {
+		mesh.uv = append([]Point2(nil), uv...)
+	}
+	if len(n) > 0 {
+		mesh.n = make([]Normal3, len(n))
+		for i := range n {
+			mesh.n[i] = objectToWorld.ApplyN(n[i])
+		}
+	}
+	if len(s) > 0 {
+		mesh.s = make([]Vec3, len(s))
+		for i := range s {
+			mesh.s[i] = objectToWorld.ApplyV(s[i])
+		}
+	}
+	return mesh
+}
+
+// Triangle is one triangle of a TriangleMesh
+type Triangle struct {
+	shape ShapeData
+	mesh  *TriangleMesh
+	// offset of the triangle's first vertex index in the mesh
+	v int
+}
+
+// CreateTriangleMesh makes the mesh and returns one shape per triangle
+func CreateTriangleMesh(objectToWorld, worldToObject *Transform, reverseOrientation bool,
+	vertexIndices []int, p []Point3, s []Vec3, n []Normal3, uv []Point2) []ShapeInter {
+	mesh := NewTriangleMesh(objectToWorld, vertexIndices, p, s, n, uv)
+	tris := make([]ShapeInter, mesh.nTriangles)
+	shape := NewShapeData(objectToWorld, worldToObject, reverseOrientation, "Triangle")
+	for i := range tris {
+		tris[i] = Triangle{shape, mesh, 3 * i}
+	}
+	return tris
+}
+
+func (self Triangle) vertices() (Point3, Point3, Point3) {
+	v := self.mesh.vertexIndices[self.v : self.v+3]
+	return self.mesh.p[v[0]], self.mesh.p[v[1]], self.mesh.p[v[2]]
+}
+
+// getUVs returns the texture coordinates of the vertices, or a default mapping
+// if the mesh has none
+func (self Triangle) getUVs() [3]Point2 {
+	if self.mesh.uv == nil {
+		return [3]Point2{{0, 0}, {1, 0}, {1, 1}}
+	}
+	v := self.mesh.vertexIndices[self.v : self.v+3]
+	return [3]Point2{self.mesh.uv[v[0]], self.mesh.uv[v[1]], self.mesh.uv[v[2]]}
+}
+
+func (self Triangle) ObjectBound() Bounds3 {
+	p0, p1, p2 := self.vertices()
+	w2o := self.shape.WorldToObject
+	return UnionB3P(NewBounds3(w2o.ApplyP(p0), w2o.ApplyP(p1)), w2o.ApplyP(p2))
+}
+
+func (self Triangle) WorldBound() Bounds3 {
+	p0, p1, p2 := self.vertices()
+	return UnionB3P(NewBounds3(p0, p1), p2)
+}
+
+/*
+intersect is the watertight ray/triangle test, the ray and the triangle are
+transformed so that the ray starts at the origin and goes down +z, which leaves
+a 2D test of the origin against the triangle's edges. It returns the distance
+along the ray and the barycentric coordinates of the hit
+*/
+func (self Triangle) intersect(ray Ray) (bool, float64, [3]float64) {
+	var b [3]float64
+	p0, p1, p2 := self.vertices()
+
+	// Translate vertices based on ray origin
+	p0t := p0.SubtractP(ray.Orig)
+	p1t := p1.SubtractP(ray.Orig)
+	p2t := p2.SubtractP(ray.Orig)
+
+	// Permute components of triangle vertices and ray direction
+	kz := AbsV3(ray.Dir).MaxDimension()
+	kx := (kz + 1) % 3
+	ky := (kx + 1) % 3
+	d := PermuteV3(ray.Dir, kx, ky, kz)
+	p0t = PermuteV3(p0t, kx, ky, kz)
+	p1t = PermuteV3(p1t, kx, ky, kz)
+	p2t = PermuteV3(p2t, kx, ky, kz)
+
+	// Apply shear transformation to translated vertex positions, z is only sheared
+	// once the hit is known to be inside
+	sx, sy, sz := -d.X/d.Z, -d.Y/d.Z, 1/d.Z
+	p0t.X += sx * p0t.Z
+	p0t.Y += sy * p0t.Z
+	p1t.X += sx * p1t.Z
+	p1t.Y += sy * p1t.Z
+	p2t.X += sx * p2t.Z
+	p2t.Y += sy * p2t.Z
+
+	// Compute edge function coefficients, the origin has to be on the same side
+	// of all three edges
+	e0 := p1t.X*p2t.Y - p1t.Y*p2t.X
+	e1 := p2t.X*p0t.Y - p2t.Y*p0t.X
+	e2 := p0t.X*p1t.Y - p0t.Y*p1t.X
+	if (e0 < 0 || e1 < 0 || e2 < 0) && (e0 > 0 || e1 > 0 || e2 > 0) {
+		return false, 0, b
+	}
+	det := e0 + e1 + e2
+	if det == 0 {
+		return false, 0, b
+	}
+
+	// Compute scaled hit distance to triangle and test against ray t range
+	p0t.Z *= sz
+	p1t.Z *= sz
+	p2t.Z *= sz
+	tScaled := e0*p0t.Z + e1*p1t.Z + e2*p2t.Z
+	if det < 0 && (tScaled >= 0 || tScaled < ray.tMax*det) {
+		return false, 0, b
+	} else if det > 0 && (tScaled <= 0 || tScaled > ray.tMax*det) {
+		return false, 0, b
+	}
+
+	// Compute barycentric coordinates and t value for triangle intersection
+	invDet := 1 / det
+	b = [3]float64{e0 * invDet, e1 * invDet, e2 * invDet}
+	t := tScaled * invDet
+
+	// Ensure that computed triangle t is conservatively greater than zero
+	maxZt := AbsV3(Vec3{p0t.Z, p1t.Z, p2t.Z}).MaxComponent()
+	deltaZ := Gamma(3) * maxZt
+	maxXt := AbsV3(Vec3{p0t.X, p1t.X, p2t.X}).MaxComponent()
+	maxYt := AbsV3(Vec3{p0t.Y, p1t.Y, p2t.Y}).MaxComponent()
+	deltaX := Gamma(5) * (maxXt + maxZt)
+	deltaY := Gamma(5) * (maxYt + maxZt)
+	deltaE := 2 * (Gamma(2)*maxXt*maxYt + deltaY*maxXt + deltaX*maxYt)
+	maxE := AbsV3(Vec3{e0, e1, e2}).MaxComponent()
+	deltaT := 3 * (Gamma(3)*maxE*maxZt + deltaE*maxZt + deltaZ*maxE) * math.Abs(invDet)
+	if t <= deltaT {
+		return false, 0, b
+	}
+	return true, t, b
+}
+
+func (self Triangle) Intersect(ray Ray, testAlphaTexture bool) (bool, float64, SurfaceInteraction) {
+	hit, t, b := self.intersect(ray)
+	if !hit {
+		return false, 0, SurfaceInteraction{}
+	}
+	p0, p1, p2 := self.vertices()
+
+	// Compute triangle partial derivatives
+	var dpdu, dpdv Vec3
+	uv := self.getUVs()
+	duv02, duv12 := uv[0].SubtractP(uv[2]), uv[1].SubtractP(uv[2])
+	dp02, dp12 := p0.SubtractP(p2), p1.SubtractP(p2)
+	determinant := duv02.X*duv12.Y - duv02.Y*duv12.X
+	degenerateUV := math.Abs(determinant) < 1e-8
+	if !degenerateUV {
+		invdet := 1 / determinant
+		dpdu = dp02.Multiply(duv12.Y).Subtract(dp12.Multiply(duv02.Y)).Multiply(invdet)
+		dpdv = dp12.Multiply(duv02.X).Subtract(dp02.Multiply(duv12.X)).Multiply(invdet)
+	}
+	if degenerateUV || CrossV3(dpdu, dpdv).MagnitudeSq() == 0 {
+		// Handle zero determinant for triangle partial derivative matrix
+		ng := CrossV3(p2.SubtractP(p0), p1.SubtractP(p0))
+		if ng.MagnitudeSq() == 0 {
+			// The triangle is actually degenerate, the intersection is bogus
+			return false, 0, SurfaceInteraction{}
+		}
+		ng = ng.Normalize()
+		MakeCoordSystem(&ng, &dpdu, &dpdv)
+	}
+
+	// Compute error bounds for triangle intersection
+	xAbsSum := math.Abs(b[0]*p0.X) + math.Abs(b[1]*p1.X) + math.Abs(b[2]*p2.X)
+	yAbsSum := math.Abs(b[0]*p0.Y) + math.Abs(b[1]*p1.Y) + math.Abs(b[2]*p2.Y)
+	zAbsSum := math.Abs(b[0]*p0.Z) + math.Abs(b[1]*p1.Z) + math.Abs(b[2]*p2.Z)
+	pError := Vec3{xAbsSum, yAbsSum, zAbsSum}.Multiply(Gamma(7))
+
+	// Interpolate uv parametric coordinates and hit point
+	pHit := p0.Multiply(b[0]).AddP(p1.Multiply(b[1])).AddP(p2.Multiply(b[2]))
+	uvHit := uv[0].Multiply(b[0]).AddP(uv[1].Multiply(b[1])).AddP(uv[2].Multiply(b[2]))
+
+	si := NewSurfaceInteraction(pHit, pError, ray.Dir.Inverse(), ray.Time, uvHit, dpdu, dpdv,
+		Normal3{}, Normal3{}, &self.shape)
+
+	// Override surface normal for triangle, the winding order decides which
+	// side is the front
+	si.inter.n = NormalFromVec3(CrossV3(dp02, dp12).Normalize())
+	si.shading.n = si.inter.n
+	mesh := self.mesh
+	v := mesh.vertexIndices[self.v : self.v+3]
+	if mesh.n != nil || mesh.s != nil {
+		// Compute shading normal ns for triangle
+		ns := si.inter.n
+		if mesh.n != nil {
+			interp := mesh.n[v[0]].Multiply(b[0]).Add(mesh.n[v[1]].Multiply(b[1])).Add(mesh.n[v[2]].Multiply(b[2]))
+			if interp.MagnitudeSq() > 0 {
+				ns = interp.Normalize()
+			}
+		}
+
+		// Compute shading tangent ss for triangle
+		ss := si.dpdu
+		if mesh.s != nil {
+			interp := mesh.s[v[0]].Multiply(b[0]).Add(mesh.s[v[1]].Multiply(b[1])).Add(mesh.s[v[2]].Multiply(b[2]))
+			if interp.MagnitudeSq() > 0 {
+				ss = interp
+			}
+		}
+
+		// Compute shading bitangent ts for triangle and adjust ss
+		ts := CrossV3(ss, ns.ToVec3())
+		if ts.MagnitudeSq() > 0 {
+			ts = ts.Normalize()
+			ss = CrossV3(ts, ns.ToVec3())
+		} else {
+			nsv := ns.ToVec3()
+			MakeCoordSystem(&nsv, &ss, &ts)
+		}
+
+		// Compute dndu and dndv for triangle shading geometry
+		var dndu, dndv Normal3
+		if mesh.n != nil {
+			dn1 := mesh.n[v[0]].Subtract(mesh.n[v[2]])
+			dn2 := mesh.n[v[1]].Subtract(mesh.n[v[2]])
+			if degenerateUV {
+				// still compute some normal variation so that e.g. bump
+				// mapping works without texture coordinates
+				dn := CrossV3(mesh.n[v[2]].Subtract(mesh.n[v[0]]).ToVec3(), mesh.n[v[1]].Subtract(mesh.n[v[0]]).ToVec3())
+				if dn.MagnitudeSq() != 0 {
+					var dnu, dnv Vec3
+					MakeCoordSystem(&dn, &dnu, &dnv)
+					dndu, dndv = NormalFromVec3(dnu), NormalFromVec3(dnv)
+				}
+			} else {
+				invDet := 1 / determinant
+				dndu = dn1.Multiply(duv12.Y).Subtract(dn2.Multiply(duv02.Y)).Multiply(invDet)
+				dndv = dn2.Multiply(duv02.X).Subtract(dn1.Multiply(duv12.X)).Multiply(invDet)
+			}
+		}
+		si.SetShadingGeometry(ss, ts, dndu, dndv, true)
+	}
+
+	// Ensure correct orientation of the geometric normal
+	if mesh.n != nil {
+		si.inter.n = FaceForward(&si.inter.n, si.shading.n.ToVec3())
+	} else if Xor(self.shape.ReverseOrientation, self.shape.TransformSwapsHandedness) {
+		si.inter.n = si.inter.n.Multiply(-1)
+		si.shading.n = si.inter.n
+	}
+	return true, t, si
+}
+
+func (self Triangle) IntersectP(ray Ray, testAlphaTexture bool) bool {
+	hit, _, _ := self.intersect(ray)
+	return hit
+}
+
+func (self Triangle) Area() float64 {
+	p0, p1, p2 := self.vertices()
+	return 0.5 * CrossV3(p1.SubtractP(p0), p2.SubtractP(p0)).Magnitude()
+}
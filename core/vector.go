@@ -53,6 +53,20 @@ func (v Vec3) Normalize() Vec3 {
 	return v.Divide(v.Magnitude())
 }
 
+// index of the component with the largest value
+func (v Vec3) MaxDimension() int {
+	if v.X > v.Y {
+		if v.X > v.Z {
+			return 0
+		}
+		return 2
+	}
+	if v.Y > v.Z {
+		return 1
+	}
+	return 2
+}
+
 func (v Vec3) MinComponent() float64 {
 	return math.Min(v.X, math.Min(v.Y, v.Z))
 }
@@ -150,6 +164,15 @@ func AbsDotV3(v, w Vec3) float64 {
 	return math.Abs(DotV3(v, w))
 }
 
+func AbsV3(v Vec3) Vec3 {
+	return Vec3{math.Abs(v.X), math.Abs(v.Y), math.Abs(v.Z)}
+}
+
+// PermuteV3 returns the vector with components v[x], v[y], v[z]
+func PermuteV3(v Vec3, x, y, z int) Vec3 {
+	return Vec3{v.Get(x), v.Get(y), v.Get(z)}
+}
+
 func CrossV3(v, w Vec3) Vec3 {
 	return Vec3{v.Y*w.Z - v.Z*w.Y, v.Z*w.X - v.X*w.Z, v.X*w.Y - v.Y*w.X}
 }
@@ -164,3 +187,20 @@ func MakeCoordSystem(v, w, u *Vec3) {
 	}
 	*u = CrossV3(*v, *w)
 }
+
+// Refract bends wi (pointing away from the surface) through the interface with
+// normal n, eta is the ratio of the indices of refraction on the side of wi over
+// the other side. It fails on total internal reflection
+func Refract(wi Vec3, n Normal3, eta float64) (bool, Vec3) {
+	// Compute cos(thetaT) using Snell's law
+	cosThetaI := DotV3(n.ToVec3(), wi)
+	sin2ThetaI := math.Max(0, 1-cosThetaI*cosThetaI)
+	sin2ThetaT := eta * eta * sin2ThetaI
+
+	// Handle total internal reflection for transmission
+	if sin2ThetaT >= 1 {
+		return false, Vec3{}
+	}
+	cosThetaT := math.Sqrt(1 - sin2ThetaT)
+	return true, wi.Inverse().Multiply(eta).Add(n.ToVec3().Multiply(eta*cosThetaI - cosThetaT))
+}
@@ -4,38 +4,70 @@ import (
 	"Anvil/parser"
 	"Anvil/system"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 func anvil_init(opt system.Options) {
-	fmt.Printf("Starting Anvil...\n")
+	if !opt.Quiet {
+		fmt.Printf("Starting Anvil...\n")
+	}
+	if opt.Verbose {
+		fmt.Printf("Rendering with %d threads\n", opt.Threads())
+	}
+	parser.Init(opt)
 }
 
-func anvil_cleanup() {
-	fmt.Printf("Shutting down Anvil...\n")
+func anvil_cleanup(opt system.Options) {
+	parser.Cleanup()
+	if !opt.Quiet {
+		fmt.Printf("Shutting down Anvil...\n")
+	}
 }
 
-func process_scene_desc(filenames []string) {
+// returns false if any of the scene files had errors
+func process_scene_desc(filenames []string) bool {
 	if len(filenames) == 0 {
 		// read scene desc from standard input
-		parser.ParseFile("-")
-	} else {
-		// parse files
-		for _, file := range filenames {
-			if !parser.ParseFile(file) {
-				system.Error(file + " could not be parsed!")
-			}
+		filenames = []string{"-"}
+	}
+	ok := true
+	for _, file := range filenames {
+		parse := parser.ParseFile
+		// render a model on its own
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".obj":
+			parse = parser.ImportOBJ
+		case ".gltf", ".glb":
+			parse = parser.ImportGLTF
+		}
+		if !parse(file) {
+			system.Error(file + " could not be parsed, " + parser.GetDiagnostics().Summary())
+			ok = false
 		}
 	}
+	return ok
 }
 
 func main() {
-	opt := system.Options{Desc: "Anvil Options"}
-	filenames := make([]string, 0)
-
 	//process command line args
+	opt, filenames, err := system.ParseArgs(os.Args[1:])
+	if err == system.ErrHelp {
+		fmt.Print(system.Usage())
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "anvil: %v\n%s", err, system.Usage())
+		os.Exit(1)
+	}
+
 	anvil_init(opt)
 
-	process_scene_desc(filenames)
+	ok := process_scene_desc(filenames)
 
-	anvil_cleanup()
+	anvil_cleanup(opt)
+	if !ok {
+		os.Exit(1)
+	}
 }
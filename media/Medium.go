@@ -1,4 +1,5 @@
 package media
 
 type Medium struct {
+	Desc string
 }
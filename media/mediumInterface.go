@@ -1,4 +1,14 @@
 package media
 
+// MediumInterface holds the media on either side of a surface, nil is vacuum
 type MediumInterface struct {
+	Inside, Outside *Medium
+}
+
+func NewMediumInterface(inside, outside *Medium) MediumInterface {
+	return MediumInterface{inside, outside}
+}
+
+func (mi MediumInterface) IsMediumTransition() bool {
+	return mi.Inside != mi.Outside
 }
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"Anvil/accelerators"
+	"Anvil/core"
+)
+
+// acceleratorConfig is an Accelerator directive checked when it's parsed, the
+// aggregates themselves are only built at WorldEnd once every primitive is known
+type acceleratorConfig struct {
+	name     string
+	maxPrims int
+	// bvh
+	splitMethod accelerators.SplitMethod
+	// kdtree
+	isectCost, traversalCost, maxDepth int
+	emptyBonus                         float64
+}
+
+func defaultAccelerator() acceleratorConfig {
+	return acceleratorConfig{name: "bvh", maxPrims: 4, splitMethod: accelerators.SplitSAH}
+}
+
+func (b *builder) accelerator(name string, params core.ParamSet) {
+	if !b.verifyOptions() {
+		return
+	}
+	c := defaultAccelerator()
+	switch name {
+	case "bvh":
+		sm := params.FindOneString("splitmethod", "sah")
+		var ok bool
+		if c.splitMethod, ok = accelerators.ParseSplitMethod(sm); !ok {
+			b.warningf("BVH split method %q unknown, using \"sah\"", sm)
+		}
+		c.maxPrims = params.FindOneInt("maxnodeprims", 4)
+	case "kdtree":
+		c.name = name
+		c.isectCost = params.FindOneInt("intersectcost", 80)
+		c.traversalCost = params.FindOneInt("traversalcost", 1)
+		c.emptyBonus = params.FindOneFloat("emptybonus", 0.5)
+		c.maxPrims = params.FindOneInt("maxprims", 1)
+		c.maxDepth = params.FindOneInt("maxdepth", -1)
+	default:
+		b.warningf("accelerator %q unknown, using \"bvh\"", name)
+	}
+	b.warnUnused(&params)
+	b.opts.AcceleratorName, b.opts.AcceleratorParams = c.name, params
+	b.opts.accel = c
+}
+
+// build makes the aggregate over prims using up to nThreads goroutines
+func (c acceleratorConfig) build(prims []core.Primitive, nThreads int) core.Primitive {
+	if c.name == "kdtree" {
+		return accelerators.NewKdTreeAccel(prims, c.isectCost, c.traversalCost, c.emptyBonus, c.maxPrims, c.maxDepth)
+	}
+	return accelerators.NewBVHAccel(prims, c.maxPrims, c.splitMethod, nThreads)
+}
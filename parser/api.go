@@ -0,0 +1,467 @@
+package parser
+
+import (
+	"Anvil/cameras"
+	"Anvil/core"
+	"Anvil/media"
+	"Anvil/system"
+	"fmt"
+	"strings"
+)
+
+// the scene description is split into an options block (camera, film...) and a
+// world block (shapes, lights...), some directives are only legal in one of them
+type apiState int
+
+const (
+	stateOptionsBlock apiState = iota
+	stateWorldBlock
+)
+
+// LightDesc records a LightSource directive until the light types are implemented
+type LightDesc struct {
+	Name         string
+	Params       core.ParamSet
+	LightToWorld core.Transform
+}
+
+// RenderOptions holds everything the scene description declared, the options
+// block settings plus the primitives and lights collected in the world block
+type RenderOptions struct {
+	FilterName, FilmName, SamplerName       string
+	FilterParams, FilmParams, SamplerParams core.ParamSet
+
+	AcceleratorName, IntegratorName     string
+	AcceleratorParams, IntegratorParams core.ParamSet
+	accel                               acceleratorConfig
+
+	CameraName    string
+	CameraParams  core.ParamSet
+	CameraToWorld *core.AnimatedTransform
+	cameraToWorld transformSet
+	// the camera itself, made at WorldEnd once the film resolution is final
+	Camera          cameras.Camera
+	cameraDirective token
+
+	// shutter interval the start and end transforms of the CTM apply at
+	TransformStartTime, TransformEndTime float64
+
+	// outside medium of the graphics state when the Camera was declared
+	CameraMedium string
+	NamedMedia   map[string]*media.Medium
+
+	Lights     []LightDesc
+	Primitives []core.Primitive
+	// primitives of each ObjectBegin/ObjectEnd definition
+	Instances map[string][]core.Primitive
+	// all of the primitives in the accelerator, built at WorldEnd
+	Aggregate core.Primitive
+}
+
+func newRenderOptions() *RenderOptions {
+	return &RenderOptions{
+		FilterName:       "box",
+		FilmName:         "image",
+		SamplerName:      "halton",
+		AcceleratorName:  "bvh",
+		accel:            defaultAccelerator(),
+		IntegratorName:   "path",
+		CameraName:       "perspective",
+		cameraToWorld:    newTransformSet(),
+		TransformEndTime: 1,
+		NamedMedia:       map[string]*media.Medium{},
+		Instances:        map[string][]core.Primitive{},
+	}
+}
+
+// builder turns directives into render options, it mirrors the pbrt api
+type builder struct {
+	state apiState
+	ctm   transformSet
+	// which of the start and end transforms the transform directives change
+	activeTransformBits int
+	opts                *RenderOptions
+	gs                  graphicsState
+	// render options of the last completed world block
+	scene *RenderOptions
+
+	pushedGraphicsStates   []graphicsState
+	pushedTransforms       []transformSet
+	pushedActiveBits       []int
+	scopes                 []scope
+	namedCoordinateSystems map[string]transformSet
+	transforms             transformCache
+
+	// name of the object being defined, shapes go there instead of the scene
+	currentInstance string
+	inInstance      bool
+	instanceUses    []instanceUse
+
+	diags *system.Diagnostics
+	// the directive being applied, problems are reported at its location
+	directive token
+	// command line options, some of them override the scene description
+	options system.Options
+
+	// files currently being parsed, outermost first, used to catch include cycles
+	files []string
+	// imported builders only collect shapes and lights from a world block
+	imported bool
+	imports  []*importJob
+	sem      chan struct{}
+}
+
+func newBuilder() *builder {
+	return &builder{
+		state:   stateOptionsBlock,
+		ctm:     newTransformSet(),
+		opts:    newRenderOptions(),
+		gs:      newGraphicsState(),
+		diags:   &system.Diagnostics{},
+		options: system.NewOptions(),
+
+		activeTransformBits:    allTransformsBits,
+		namedCoordinateSystems: map[string]transformSet{},
+		transforms:             transformCache{},
+	}
+}
+
+func (b *builder) errorf(format string, a ...interface{}) {
+	b.diags.Errorf(b.directive.loc, b.directive.text, format, a...)
+}
+
+func (b *builder) warningf(format string, a ...interface{}) {
+	b.diags.Warningf(b.directive.loc, b.directive.text, format, a...)
+}
+
+func (b *builder) verifyOptions() bool {
+	if b.state == stateWorldBlock {
+		b.errorf("options cannot be set inside world block")
+		return false
+	}
+	return true
+}
+
+func (b *builder) verifyWorld() bool {
+	if b.state == stateOptionsBlock {
+		b.errorf("scene description must be inside world block")
+		return false
+	}
+	return true
+}
+
+func (b *builder) warnUnused(params *core.ParamSet) {
+	if unused := params.Unused(); len(unused) > 0 {
+		b.warningf("unused parameter(s) %s", strings.Join(unused, ", "))
+	}
+}
+
+// ---------- transform directives ----------
+
+// the CTM is a pair of transforms for the start and the end of the shutter
+// interval, they only differ when ActiveTransform was used to animate it
+type transformSet [2]core.Transform
+
+const (
+	startTransformBits = 1 << iota
+	endTransformBits
+	allTransformsBits = startTransformBits | endTransformBits
+)
+
+func newTransformSet() transformSet {
+	return transformSet{core.NewTransform(), core.NewTransform()}
+}
+
+func (ts transformSet) isAnimated() bool {
+	return !core.IsEqualTransform(ts[0], ts[1])
+}
+
+func (ts transformSet) inverse() transformSet {
+	return transformSet{ts[0].Inverse(), ts[1].Inverse()}
+}
+
+// apply replaces the active transforms of the CTM by f of them
+func (b *builder) apply(f func(t core.Transform) core.Transform) {
+	for i := range b.ctm {
+		if b.activeTransformBits&(1<<i) != 0 {
+			b.ctm[i] = f(b.ctm[i])
+		}
+	}
+}
+
+// animatedTransform moves between the transforms of ts over the shutter interval
+func (b *builder) animatedTransform(ts transformSet) *core.AnimatedTransform {
+	start, _ := b.transforms.lookup(ts[0])
+	end, _ := b.transforms.lookup(ts[1])
+	return core.NewAnimatedTransform(start, b.opts.TransformStartTime, end, b.opts.TransformEndTime)
+}
+
+func (b *builder) identity() {
+	b.apply(func(core.Transform) core.Transform { return core.NewTransform() })
+}
+
+func (b *builder) translate(dx, dy, dz float64) {
+	b.concat(core.Translate(core.Vec3{X: dx, Y: dy, Z: dz}))
+}
+
+func (b *builder) rotate(angle, dx, dy, dz float64) {
+	b.concat(core.RotateFromAxis(angle, core.Vec3{X: dx, Y: dy, Z: dz}))
+}
+
+func (b *builder) scale(sx, sy, sz float64) {
+	b.concat(core.Scale(sx, sy, sz))
+}
+
+func (b *builder) lookAt(ex, ey, ez, lx, ly, lz, ux, uy, uz float64) {
+	b.concat(core.LookAt(core.Point3{X: ex, Y: ey, Z: ez}, core.Point3{X: lx, Y: ly, Z: lz},
+		core.Vec3{X: ux, Y: uy, Z: uz}))
+}
+
+func (b *builder) concat(t core.Transform) {
+	b.apply(func(ctm core.Transform) core.Transform { return core.ConcatTransforms(ctm, t) })
+}
+
+// scene files store matrices column major, core matrices are row major
+func matFromColumnMajor(tr []float64) core.Matrix4x4f {
+	return core.NewMat4x4f(tr[0], tr[4], tr[8], tr[12],
+		tr[1], tr[5], tr[9], tr[13],
+		tr[2], tr[6], tr[10], tr[14],
+		tr[3], tr[7], tr[11], tr[15])
+}
+
+func (b *builder) transform(tr []float64) {
+	t := core.NewTransformFromMat(matFromColumnMajor(tr))
+	b.apply(func(core.Transform) core.Transform { return t })
+}
+
+func (b *builder) concatTransform(tr []float64) {
+	b.concat(core.NewTransformFromMat(matFromColumnMajor(tr)))
+}
+
+// activeTransform selects which of the start and end transforms the following
+// transform directives change
+func (b *builder) activeTransform(which string) {
+	switch which {
+	case "StartTime":
+		b.activeTransformBits = startTransformBits
+	case "EndTime":
+		b.activeTransformBits = endTransformBits
+	case "All":
+		b.activeTransformBits = allTransformsBits
+	default:
+		b.errorf("unknown ActiveTransform type %q, expected StartTime, EndTime or All", which)
+	}
+}
+
+func (b *builder) transformTimes(start, end float64) {
+	if !b.verifyOptions() {
+		return
+	}
+	if end < start {
+		b.errorf("transform end time %v is before the start time %v", end, start)
+		return
+	}
+	b.opts.TransformStartTime, b.opts.TransformEndTime = start, end
+}
+
+// ---------- options block directives ----------
+
+func (b *builder) pixelFilter(name string, params core.ParamSet) {
+	if b.verifyOptions() {
+		b.opts.FilterName, b.opts.FilterParams = name, params
+	}
+}
+
+func (b *builder) film(name string, params core.ParamSet) {
+	if b.verifyOptions() {
+		b.opts.FilmName, b.opts.FilmParams = name, params
+	}
+}
+
+func (b *builder) sampler(name string, params core.ParamSet) {
+	if b.verifyOptions() {
+		b.opts.SamplerName, b.opts.SamplerParams = name, params
+	}
+}
+
+func (b *builder) integrator(name string, params core.ParamSet) {
+	if b.verifyOptions() {
+		b.opts.IntegratorName, b.opts.IntegratorParams = name, params
+	}
+}
+
+func (b *builder) camera(name string, params core.ParamSet) {
+	if !b.verifyOptions() {
+		return
+	}
+	b.opts.CameraName, b.opts.CameraParams = name, params
+	b.opts.cameraDirective = b.directive
+	b.opts.cameraToWorld = b.ctm.inverse()
+	b.opts.CameraMedium = b.gs.currentOutsideMedium
+	b.namedCoordinateSystems["camera"] = b.opts.cameraToWorld
+}
+
+func (b *builder) worldBegin() {
+	if b.imported {
+		b.errorf("WorldBegin not allowed in an imported file")
+		return
+	}
+	if !b.verifyOptions() {
+		return
+	}
+	b.state = stateWorldBlock
+	b.ctm = newTransformSet()
+	b.activeTransformBits = allTransformsBits
+	b.namedCoordinateSystems["world"] = b.ctm
+}
+
+func (b *builder) worldEnd() {
+	if b.imported {
+		b.errorf("WorldEnd not allowed in an imported file")
+		return
+	}
+	if !b.verifyWorld() {
+		return
+	}
+	b.waitImports()
+	b.closeScopes()
+	b.resolveInstances()
+	b.opts.Aggregate = b.opts.accel.build(b.opts.Primitives, b.options.Threads())
+	b.opts.CameraToWorld = b.animatedTransform(b.opts.cameraToWorld)
+	b.applyOptions(b.opts)
+	b.opts.Camera = b.makeCamera(b.opts)
+	b.scene = b.opts
+	b.state = stateOptionsBlock
+	b.ctm = newTransformSet()
+	b.activeTransformBits = allTransformsBits
+	b.opts = newRenderOptions()
+	b.gs = newGraphicsState()
+	b.namedCoordinateSystems = map[string]transformSet{}
+	b.transforms = transformCache{}
+}
+
+// ---------- world block directives ----------
+
+func (b *builder) material(name string, params core.ParamSet) {
+	if b.verifyWorld() {
+		b.gs.material = &core.Material{Desc: name, Params: params}
+	}
+}
+
+func (b *builder) texture(name, typ, class string, params core.ParamSet) {
+	if b.verifyWorld() {
+		b.warningf("texture %q of class %q ignored, textures are not supported yet", name, class)
+	}
+}
+
+func (b *builder) lightSource(name string, params core.ParamSet) {
+	if !b.verifyWorld() {
+		return
+	}
+	if b.ctm.isAnimated() {
+		b.warningf("animated lights aren't supported, using the start transform")
+	}
+	b.opts.Lights = append(b.opts.Lights, LightDesc{name, params, b.ctm[0]})
+}
+
+func (b *builder) areaLightSource(name string, params core.ParamSet) {
+	if b.verifyWorld() {
+		b.gs.areaLightName, b.gs.areaLightParams = name, params
+	}
+}
+
+func (b *builder) shape(name string, params core.ParamSet) {
+	if !b.verifyWorld() {
+		return
+	}
+	// animated shapes are made in object space and moved by a TransformedPrimitive
+	ctm := b.ctm[0]
+	if b.ctm.isAnimated() {
+		ctm = core.NewTransform()
+	}
+	objToWorld, worldToObj := b.transforms.lookup(ctm)
+	if name == "objmesh" {
+		// OBJ files bring their own materials
+		b.loadOBJMesh(objToWorld, worldToObj, &params)
+		return
+	}
+	shapes, err := b.makeShapes(name, objToWorld, worldToObj, b.gs.reverseOrientation, &params)
+	if err != nil {
+		b.errorf("%v", err)
+		return
+	}
+	if shapes == nil {
+		b.warningf("shape %q unknown", name)
+		return
+	}
+	b.warnUnused(&params)
+	b.addShapes(shapes, b.gs.material)
+}
+
+// addShapes makes primitives out of shapes with the current graphics state and
+// adds them to the scene or to the instance being defined, shapes under an
+// animated CTM are wrapped in a single TransformedPrimitive
+func (b *builder) addShapes(shapes []core.ShapeInter, material *core.Material) {
+	mi, ok := b.currentMediumInterface()
+	if !ok {
+		return
+	}
+	animated := b.ctm.isAnimated()
+	var areaLight *core.AreaLight
+	if b.gs.areaLightName != "" {
+		if b.inInstance {
+			b.warningf("area lights not supported with object instancing")
+		} else if animated {
+			b.warningf("area lights not supported with animated shapes")
+		} else {
+			areaLight = &core.AreaLight{}
+		}
+	}
+	prims := make([]core.Primitive, len(shapes))
+	for i, s := range shapes {
+		prims[i] = core.NewGeometricPrimitive(s, material, areaLight, mi)
+	}
+	if animated && len(prims) > 0 {
+		prim := prims[0]
+		if len(prims) > 1 {
+			prim = b.opts.accel.build(prims, b.options.Threads())
+		}
+		prims = []core.Primitive{core.NewTransformedPrimitive(prim, b.animatedTransform(b.ctm))}
+	}
+	if b.inInstance {
+		b.opts.Instances[b.currentInstance] = append(b.opts.Instances[b.currentInstance], prims...)
+	} else {
+		b.opts.Primitives = append(b.opts.Primitives, prims...)
+	}
+}
+
+// applyOptions folds the command line options into the scene's parameters the same
+// way pbrt does when it creates the film, sampler and integrator
+func (b *builder) applyOptions(ro *RenderOptions) {
+	opt := b.options
+	if opt.ImageFile != "" {
+		if f := ro.FilmParams.FindOneString("filename", ""); f != "" && f != opt.ImageFile {
+			b.warningf("output filename %q from the command line overrides %q from the scene", opt.ImageFile, f)
+		}
+		ro.FilmParams.AddStrings("filename", "string", []string{opt.ImageFile})
+	}
+	if opt.HasCropWindow() {
+		c := opt.CropWindow
+		ro.FilmParams.AddFloats("cropwindow", "float", []float64{c[0][0], c[0][1], c[1][0], c[1][1]})
+	}
+	if opt.SeedSet {
+		ro.SamplerParams.AddFloats("seed", "integer", []float64{float64(opt.Seed)})
+	}
+	if opt.Quick {
+		xRes := ro.FilmParams.FindOneInt("xresolution", 1280)
+		yRes := ro.FilmParams.FindOneInt("yresolution", 720)
+		ro.FilmParams.AddFloats("xresolution", "integer", []float64{float64(max(1, xRes/4))})
+		ro.FilmParams.AddFloats("yresolution", "integer", []float64{float64(max(1, yRes/4))})
+		ro.SamplerParams.AddFloats("pixelsamples", "integer", []float64{1})
+	}
+	if opt.Verbose {
+		fmt.Printf("Scene: %d primitives, %d lights, camera %q, film %q, sampler %q, accelerator %q, integrator %q\n",
+			len(ro.Primitives), len(ro.Lights), ro.CameraName, ro.FilmName, ro.SamplerName,
+			ro.AcceleratorName, ro.IntegratorName)
+	}
+}
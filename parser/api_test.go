@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"Anvil/system"
+	"testing"
+)
+
+// --seed overrides the scene's sampler seed, 0 included
+func TestApplyOptionsSeed(t *testing.T) {
+	tests := []struct {
+		args []string
+		seed int
+	}{
+		{nil, 5},
+		{[]string{"--seed", "0"}, 0},
+		{[]string{"--seed", "9"}, 9},
+	}
+	for _, test := range tests {
+		opt, _, err := system.ParseArgs(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := newBuilder()
+		b.options = opt
+		ro := newRenderOptions()
+		ro.SamplerParams.AddFloats("seed", "integer", []float64{5})
+		b.applyOptions(ro)
+		if seed := ro.SamplerParams.FindOneInt("seed", -1); seed != test.seed {
+			t.Errorf("%q: seed %d, expected %d", test.args, seed, test.seed)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"Anvil/cameras"
+	"Anvil/core"
+	"Anvil/media"
+	"Anvil/system"
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cameraScreenWindow is the part of screen space the film covers, [-1, 1] along the
+// shorter side of the film unless "screenwindow" says otherwise
+func cameraScreenWindow(params *core.ParamSet, fullResolution core.Point2) (core.Bounds2, error) {
+	frame := params.FindOneFloat("frameaspectratio", fullResolution.X/fullResolution.Y)
+	screen := core.NewBounds2(core.Point2{X: -1, Y: -1 / frame}, core.Point2{X: 1, Y: 1 / frame})
+	if frame > 1 {
+		screen = core.NewBounds2(core.Point2{X: -frame, Y: -1}, core.Point2{X: frame, Y: 1})
+	}
+	if sw := params.FindFloat("screenwindow"); sw != nil {
+		if len(sw) != 4 {
+			return screen, fmt.Errorf("\"screenwindow\" should have four values")
+		}
+		screen = core.NewBounds2(core.Point2{X: sw[0], Y: sw[2]}, core.Point2{X: sw[1], Y: sw[3]})
+	}
+	return screen, nil
+}
+
+func makePerspectiveCamera(params *core.ParamSet, cameraToWorld *core.AnimatedTransform, shutter cameras.Shutter,
+	fullResolution core.Point2, medium *media.Medium) (cameras.Camera, error) {
+	lensRadius := params.FindOneFloat("lensradius", 0)
+	focalDistance := params.FindOneFloat("focaldistance", 1e6)
+	screen, err := cameraScreenWindow(params, fullResolution)
+	if err != nil {
+		return nil, err
+	}
+	fov := params.FindOneFloat("fov", 90)
+	if halfFov := params.FindOneFloat("halffov", -1); halfFov > 0 {
+		// hack for structure synth, which exports half of the full fov
+		fov = 2 * halfFov
+	}
+	return cameras.NewPerspectiveCamera(cameraToWorld, shutter, screen, fullResolution, lensRadius, focalDistance,
+		fov, medium), nil
+}
+
+func makeOrthographicCamera(params *core.ParamSet, cameraToWorld *core.AnimatedTransform, shutter cameras.Shutter,
+	fullResolution core.Point2, medium *media.Medium) (cameras.Camera, error) {
+	lensRadius := params.FindOneFloat("lensradius", 0)
+	focalDistance := params.FindOneFloat("focaldistance", 1e6)
+	screen, err := cameraScreenWindow(params, fullResolution)
+	if err != nil {
+		return nil, err
+	}
+	return cameras.NewOrthographicCamera(cameraToWorld, shutter, screen, fullResolution, lensRadius, focalDistance,
+		medium), nil
+}
+
+func makeEnvironmentCamera(params *core.ParamSet, cameraToWorld *core.AnimatedTransform, shutter cameras.Shutter,
+	fullResolution core.Point2, medium *media.Medium) (cameras.Camera, error) {
+	return cameras.NewEnvironmentCamera(cameraToWorld, shutter, fullResolution, medium), nil
+}
+
+// makeRealisticCamera loads the lens file, the aperture stop of the lens gets the
+// diameter of the "aperturediameter" parameter
+func (b *builder) makeRealisticCamera(params *core.ParamSet, cameraToWorld *core.AnimatedTransform,
+	shutter cameras.Shutter, fullResolution core.Point2, filmDiagonal float64, medium *media.Medium) (cameras.Camera, error) {
+	lensFile := params.FindOneString("lensfile", "")
+	apertureDiameter := params.FindOneFloat("aperturediameter", 1)
+	focusDistance := params.FindOneFloat("focusdistance", 10)
+	simpleWeighting := params.FindOneBool("simpleweighting", true)
+	if lensFile == "" {
+		return nil, fmt.Errorf("no lens description file supplied")
+	}
+	lensData, err := readFloatFile(resolvePath(b.directive.loc.Filename, lensFile))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read lens file: %v", err)
+	}
+	for i := 0; i+3 < len(lensData); i += 4 {
+		if lensData[i] != 0 {
+			continue
+		}
+		if apertureDiameter > lensData[i+3] {
+			b.warningf("aperture diameter %v is greater than the maximum possible %v, clamping it",
+				apertureDiameter, lensData[i+3])
+		} else {
+			lensData[i+3] = apertureDiameter
+		}
+	}
+	camera, err := cameras.NewRealisticCamera(cameraToWorld, shutter, fullResolution, filmDiagonal, lensData,
+		focusDistance, simpleWeighting, medium)
+	if err != nil {
+		return nil, err
+	}
+	return camera, nil
+}
+
+// readFloatFile reads whitespace separated numbers, # comments out the rest of a line
+func readFloatFile(filename string) ([]float64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values []float64
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		for _, field := range strings.Fields(text) {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				loc := system.Loc{Filename: filename, Line: line, Column: 1}
+				return nil, fmt.Errorf("%v: %q is not a number", loc, field)
+			}
+			values = append(values, v)
+		}
+	}
+	return values, s.Err()
+}
+
+// makeShutter reads the shutter interval, its curve and how much of the interval
+// a rolling shutter takes to reach the bottom of the film
+func (b *builder) makeShutter(params *core.ParamSet) (cameras.Shutter, error) {
+	open := params.FindOneFloat("shutteropen", 0)
+	close := params.FindOneFloat("shutterclose", 1)
+	if close < open {
+		b.warningf("shutter close time %v < shutter open %v, swapping them", close, open)
+		open, close = close, open
+	}
+
+	curve := cameras.BoxShutterCurve()
+	ramp := params.FindOneFloat("shutterramp", 0)
+	values := params.FindFloat("shuttercurve")
+	var err error
+	switch {
+	case ramp != 0 && values != nil:
+		return cameras.Shutter{}, fmt.Errorf("only one of \"shutterramp\" and \"shuttercurve\" can be given")
+	case ramp != 0:
+		curve, err = cameras.TrapezoidShutterCurve(ramp)
+	case values != nil:
+		curve, err = cameras.TabulatedShutterCurve(values)
+	}
+	if err != nil {
+		return cameras.Shutter{}, err
+	}
+
+	rolling := params.FindOneFloat("rollingshutter", 0)
+	if rolling < 0 || rolling > 1 {
+		b.warningf("rolling shutter %v should be in [0, 1], clamping it", rolling)
+	}
+	return cameras.NewShutter(open, close, curve, rolling), nil
+}
+
+// makeCamera creates the camera of the Camera directive for the film resolution
+// of ro, problems are reported at the Camera directive
+func (b *builder) makeCamera(ro *RenderOptions) cameras.Camera {
+	directive := b.directive
+	b.directive = ro.cameraDirective
+	defer func() { b.directive = directive }()
+
+	var medium *media.Medium
+	if ro.CameraMedium != "" {
+		var ok bool
+		if medium, ok = ro.NamedMedia[ro.CameraMedium]; !ok {
+			b.errorf("named medium %q undefined", ro.CameraMedium)
+		}
+	}
+	fullResolution := core.Point2{X: float64(ro.FilmParams.FindOneInt("xresolution", 1280)),
+		Y: float64(ro.FilmParams.FindOneInt("yresolution", 720))}
+
+	shutter, err := b.makeShutter(&ro.CameraParams)
+	if err != nil {
+		b.errorf("%v", err)
+		return nil
+	}
+
+	var camera cameras.Camera
+	switch ro.CameraName {
+	case "perspective":
+		camera, err = makePerspectiveCamera(&ro.CameraParams, ro.CameraToWorld, shutter, fullResolution, medium)
+	case "orthographic":
+		camera, err = makeOrthographicCamera(&ro.CameraParams, ro.CameraToWorld, shutter, fullResolution, medium)
+	case "environment":
+		camera, err = makeEnvironmentCamera(&ro.CameraParams, ro.CameraToWorld, shutter, fullResolution, medium)
+	case "realistic":
+		filmDiagonal := ro.FilmParams.FindOneFloat("diagonal", 35)
+		camera, err = b.makeRealisticCamera(&ro.CameraParams, ro.CameraToWorld, shutter, fullResolution,
+			filmDiagonal, medium)
+	default:
+		b.errorf("camera %q unknown", ro.CameraName)
+		return nil
+	}
+	if err != nil {
+		b.errorf("%v", err)
+		return nil
+	}
+	b.warnUnused(&ro.CameraParams)
+	return camera
+}
@@ -0,0 +1,761 @@
+package parser
+
+import (
+	"Anvil/core"
+	"Anvil/system"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// the parts of the glTF 2.0 JSON the importer uses, optional values that have a
+// non zero default are pointers
+type gltfDoc struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+	Scene              *int     `json:"scene"`
+	Scenes             []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes     []gltfNode     `json:"nodes"`
+	Meshes    []gltfMesh     `json:"meshes"`
+	Materials []gltfMaterial `json:"materials"`
+	Textures  []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+	Cameras    []gltfCamera `json:"cameras"`
+	Extensions struct {
+		LightsPunctual struct {
+			Lights []gltfLight `json:"lights"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfNode struct {
+	Children    []int     `json:"children"`
+	Mesh        *int      `json:"mesh"`
+	Camera      *int      `json:"camera"`
+	Matrix      []float64 `json:"matrix"`
+	Translation []float64 `json:"translation"`
+	Rotation    []float64 `json:"rotation"`
+	Scale       []float64 `json:"scale"`
+	Extensions  struct {
+		LightsPunctual struct {
+			Light *int `json:"light"`
+		} `json:"KHR_lights_punctual"`
+	} `json:"extensions"`
+}
+
+type gltfMesh struct {
+	Primitives []struct {
+		Attributes map[string]int `json:"attributes"`
+		Indices    *int           `json:"indices"`
+		Material   *int           `json:"material"`
+		Mode       *int           `json:"mode"`
+	} `json:"primitives"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfMaterial struct {
+	Name                 string `json:"name"`
+	PBRMetallicRoughness struct {
+		BaseColorFactor          []float64        `json:"baseColorFactor"`
+		BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+		MetallicFactor           *float64         `json:"metallicFactor"`
+		RoughnessFactor          *float64         `json:"roughnessFactor"`
+		MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+	} `json:"pbrMetallicRoughness"`
+	NormalTexture  *gltfTextureInfo `json:"normalTexture"`
+	EmissiveFactor []float64        `json:"emissiveFactor"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int             `json:"bufferView"`
+	ByteOffset    int              `json:"byteOffset"`
+	ComponentType int              `json:"componentType"`
+	Normalized    bool             `json:"normalized"`
+	Count         int              `json:"count"`
+	Type          string           `json:"type"`
+	Sparse        *json.RawMessage `json:"sparse"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfCamera struct {
+	Type        string `json:"type"`
+	Perspective *struct {
+		AspectRatio *float64 `json:"aspectRatio"`
+		Yfov        float64  `json:"yfov"`
+	} `json:"perspective"`
+}
+
+type gltfLight struct {
+	Type      string    `json:"type"`
+	Color     []float64 `json:"color"`
+	Intensity *float64  `json:"intensity"`
+	Spot      *struct {
+		InnerConeAngle float64  `json:"innerConeAngle"`
+		OuterConeAngle *float64 `json:"outerConeAngle"`
+	} `json:"spot"`
+}
+
+// gltfFile is a parsed .gltf or .glb file with its buffers loaded
+type gltfFile struct {
+	filename string
+	doc      gltfDoc
+	buffers  [][]byte
+}
+
+const (
+	glbMagic     = 0x46546c67 // "glTF"
+	glbChunkJSON = 0x4e4f534a
+	glbChunkBIN  = 0x004e4942
+)
+
+func readGLTF(filename string) (*gltfFile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	g := &gltfFile{filename: filename}
+
+	// Binary files wrap the JSON and the first buffer in chunks
+	jsonData, bin := data, []byte(nil)
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonData, bin, err = readGLBChunks(data); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	if err := json.Unmarshal(jsonData, &g.doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if !strings.HasPrefix(g.doc.Asset.Version, "2") {
+		return nil, fmt.Errorf("%s: glTF version %q not supported, only 2.x is", filename, g.doc.Asset.Version)
+	}
+	for _, ext := range g.doc.ExtensionsRequired {
+		if ext != "KHR_lights_punctual" {
+			return nil, fmt.Errorf("%s: requires unsupported extension %s", filename, ext)
+		}
+	}
+
+	for i, buf := range g.doc.Buffers {
+		var data []byte
+		switch {
+		case buf.URI == "" && i == 0 && bin != nil:
+			data = bin
+		case strings.HasPrefix(buf.URI, "data:"):
+			comma := strings.IndexByte(buf.URI, ',')
+			if comma < 0 || !strings.HasSuffix(buf.URI[:comma], ";base64") {
+				return nil, fmt.Errorf("%s: buffer %d: only base64 data URIs are supported", filename, i)
+			}
+			if data, err = base64.StdEncoding.DecodeString(buf.URI[comma+1:]); err != nil {
+				return nil, fmt.Errorf("%s: buffer %d: %v", filename, i, err)
+			}
+		case buf.URI != "":
+			path, err := url.PathUnescape(buf.URI)
+			if err != nil {
+				path = buf.URI
+			}
+			if data, err = os.ReadFile(resolvePath(filename, path)); err != nil {
+				return nil, fmt.Errorf("%s: buffer %d: %v", filename, i, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s: buffer %d has no data", filename, i)
+		}
+		if len(data) < buf.ByteLength {
+			return nil, fmt.Errorf("%s: buffer %d is %d bytes, expected %d", filename, i, len(data), buf.ByteLength)
+		}
+		g.buffers = append(g.buffers, data)
+	}
+	return g, nil
+}
+
+func readGLBChunks(data []byte) (jsonData, bin []byte, err error) {
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, nil, fmt.Errorf("GLB version %d not supported", version)
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("GLB file truncated")
+	}
+	for pos := 12; pos+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[pos:]))
+		chunkType := binary.LittleEndian.Uint32(data[pos+4:])
+		start := pos + 8
+		if start+chunkLength > length {
+			return nil, nil, fmt.Errorf("GLB chunk overruns the file")
+		}
+		switch chunkType {
+		case glbChunkJSON:
+			jsonData = data[start : start+chunkLength]
+		case glbChunkBIN:
+			if bin == nil {
+				bin = data[start : start+chunkLength]
+			}
+		}
+		pos = start + chunkLength
+	}
+	if jsonData == nil {
+		return nil, nil, fmt.Errorf("GLB file has no JSON chunk")
+	}
+	return jsonData, bin, nil
+}
+
+// accessor reads an accessor as floats, n per element. Normalized integers are
+// mapped to [0, 1] or [-1, 1]
+func (g *gltfFile) accessor(i int, typ string) ([]float64, error) {
+	if i < 0 || i >= len(g.doc.Accessors) {
+		return nil, fmt.Errorf("accessor %d doesn't exist", i)
+	}
+	a := g.doc.Accessors[i]
+	if a.Type != typ {
+		return nil, fmt.Errorf("accessor %d is %s, expected %s", i, a.Type, typ)
+	}
+	n := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3, "VEC4": 4, "MAT4": 16}[a.Type]
+	if a.Sparse != nil || a.BufferView == nil {
+		return nil, fmt.Errorf("accessor %d: sparse accessors aren't supported", i)
+	}
+	size, ok := map[int]int{5120: 1, 5121: 1, 5122: 2, 5123: 2, 5125: 4, 5126: 4}[a.ComponentType]
+	if !ok {
+		return nil, fmt.Errorf("accessor %d: unknown component type %d", i, a.ComponentType)
+	}
+	if *a.BufferView < 0 || *a.BufferView >= len(g.doc.BufferViews) {
+		return nil, fmt.Errorf("accessor %d: buffer view %d doesn't exist", i, *a.BufferView)
+	}
+	bv := g.doc.BufferViews[*a.BufferView]
+	if bv.Buffer < 0 || bv.Buffer >= len(g.buffers) {
+		return nil, fmt.Errorf("accessor %d: buffer %d doesn't exist", i, bv.Buffer)
+	}
+	stride := bv.ByteStride
+	if stride == 0 {
+		stride = n * size
+	}
+	start := bv.ByteOffset + a.ByteOffset
+	if a.Count > 0 && (start < 0 || start+(a.Count-1)*stride+n*size > bv.ByteOffset+bv.ByteLength ||
+		bv.ByteOffset+bv.ByteLength > len(g.buffers[bv.Buffer])) {
+		return nil, fmt.Errorf("accessor %d overruns its buffer", i)
+	}
+
+	buf := g.buffers[bv.Buffer]
+	ret := make([]float64, a.Count*n)
+	for e := 0; e < a.Count; e++ {
+		for c := 0; c < n; c++ {
+			b := buf[start+e*stride+c*size:]
+			var v float64
+			switch a.ComponentType {
+			case 5120:
+				v = float64(int8(b[0]))
+				if a.Normalized {
+					v = math.Max(v/127, -1)
+				}
+			case 5121:
+				v = float64(b[0])
+				if a.Normalized {
+					v /= 255
+				}
+			case 5122:
+				v = float64(int16(binary.LittleEndian.Uint16(b)))
+				if a.Normalized {
+					v = math.Max(v/32767, -1)
+				}
+			case 5123:
+				v = float64(binary.LittleEndian.Uint16(b))
+				if a.Normalized {
+					v /= 65535
+				}
+			case 5125:
+				v = float64(binary.LittleEndian.Uint32(b))
+			default:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			}
+			ret[e*n+c] = v
+		}
+	}
+	return ret, nil
+}
+
+// the attribute's error, or a count mismatch when it read fine
+func gltfAttributeError(err error) error {
+	if err == nil {
+		return fmt.Errorf("count doesn't match POSITION")
+	}
+	return err
+}
+
+// gltfShape is a mesh primitive placed in the world
+type gltfShape struct {
+	toWorld  core.Transform
+	indices  []int
+	p        []core.Point3
+	n        []core.Normal3
+	s        []core.Vec3
+	uv       []core.Point2
+	material *core.Material
+}
+
+// gltfScene is everything collected from the node hierarchy of the default scene
+type gltfScene struct {
+	file      *gltfFile
+	materials map[int]*core.Material
+	shapes    []gltfShape
+	lights    []LightDesc
+	bounds    core.Bounds3
+
+	// the first camera found, if any
+	hasCamera      bool
+	cameraToWorld  core.Transform
+	cameraParams   core.ParamSet
+	aspectRatio    float64
+	ignoredCameras int
+}
+
+// gltfNodeTransform is the node's local transform, either a matrix or a
+// translation, rotation and scale applied in that order
+func gltfNodeTransform(node *gltfNode) core.Transform {
+	if len(node.Matrix) == 16 {
+		return core.NewTransformFromMat(matFromColumnMajor(node.Matrix))
+	}
+	t := core.NewTransform()
+	if len(node.Translation) == 3 {
+		t = core.Translate(core.Vec3{X: node.Translation[0], Y: node.Translation[1], Z: node.Translation[2]})
+	}
+	if len(node.Rotation) == 4 {
+		// unit quaternion x, y, z, w to a rotation matrix, the inverse is the transpose
+		x, y, z, w := node.Rotation[0], node.Rotation[1], node.Rotation[2], node.Rotation[3]
+		m := core.NewMat4x4f(
+			1-2*(y*y+z*z), 2*(x*y-z*w), 2*(x*z+y*w), 0,
+			2*(x*y+z*w), 1-2*(x*x+z*z), 2*(y*z-x*w), 0,
+			2*(x*z-y*w), 2*(y*z+x*w), 1-2*(x*x+y*y), 0,
+			0, 0, 0, 1)
+		t = core.ConcatTransforms(t, core.NewTransformWithInv(m, m.Transpose()))
+	}
+	if len(node.Scale) == 3 {
+		t = core.ConcatTransforms(t, core.Scale(node.Scale[0], node.Scale[1], node.Scale[2]))
+	}
+	return t
+}
+
+// gltfScene walks the nodes of the default scene
+func (b *builder) gltfScene(g *gltfFile) *gltfScene {
+	sc := &gltfScene{file: g, materials: map[int]*core.Material{}, bounds: core.NewEmptyBounds3()}
+	var roots []int
+	switch {
+	case g.doc.Scene != nil && *g.doc.Scene >= 0 && *g.doc.Scene < len(g.doc.Scenes):
+		roots = g.doc.Scenes[*g.doc.Scene].Nodes
+	case len(g.doc.Scenes) > 0:
+		roots = g.doc.Scenes[0].Nodes
+	default:
+		// no scene, show every node that isn't a child
+		isChild := make([]bool, len(g.doc.Nodes))
+		for _, node := range g.doc.Nodes {
+			for _, c := range node.Children {
+				if c >= 0 && c < len(isChild) {
+					isChild[c] = true
+				}
+			}
+		}
+		for i := range g.doc.Nodes {
+			if !isChild[i] {
+				roots = append(roots, i)
+			}
+		}
+	}
+	onPath := make([]bool, len(g.doc.Nodes))
+	for _, root := range roots {
+		b.gltfNode(sc, root, core.NewTransform(), onPath)
+	}
+	if sc.ignoredCameras > 0 {
+		b.warningf("only the first perspective camera is used, %d other(s) ignored", sc.ignoredCameras)
+	}
+	return sc
+}
+
+func (b *builder) gltfNode(sc *gltfScene, i int, parentToWorld core.Transform, onPath []bool) {
+	doc := &sc.file.doc
+	if i < 0 || i >= len(doc.Nodes) {
+		b.warningf("node %d doesn't exist", i)
+		return
+	}
+	if onPath[i] {
+		b.warningf("node %d is its own ancestor, ignoring it", i)
+		return
+	}
+	onPath[i] = true
+	defer func() { onPath[i] = false }()
+
+	node := &doc.Nodes[i]
+	nodeToWorld := core.ConcatTransforms(parentToWorld, gltfNodeTransform(node))
+	if node.Mesh != nil {
+		b.gltfMesh(sc, *node.Mesh, nodeToWorld)
+	}
+	if node.Camera != nil {
+		b.gltfCamera(sc, *node.Camera, nodeToWorld)
+	}
+	if light := node.Extensions.LightsPunctual.Light; light != nil {
+		b.gltfLight(sc, *light, nodeToWorld)
+	}
+	for _, c := range node.Children {
+		b.gltfNode(sc, c, nodeToWorld, onPath)
+	}
+}
+
+func (b *builder) gltfMesh(sc *gltfScene, i int, toWorld core.Transform) {
+	g := sc.file
+	if i < 0 || i >= len(g.doc.Meshes) {
+		b.warningf("mesh %d doesn't exist", i)
+		return
+	}
+	for j, prim := range g.doc.Meshes[i].Primitives {
+		shape, err := b.gltfPrimitive(sc, prim.Attributes, prim.Indices, prim.Mode)
+		if err != nil {
+			b.warningf("mesh %d primitive %d skipped: %v", i, j, err)
+			continue
+		}
+		shape.toWorld = toWorld
+		shape.material = sc.material(b, prim.Material)
+		for _, p := range shape.p {
+			sc.bounds = core.UnionB3P(sc.bounds, toWorld.ApplyP(p))
+		}
+		sc.shapes = append(sc.shapes, shape)
+	}
+}
+
+func (b *builder) gltfPrimitive(sc *gltfScene, attributes map[string]int, indicesAccessor, mode *int) (gltfShape, error) {
+	var shape gltfShape
+	g := sc.file
+	if mode != nil && *mode != 4 && *mode != 5 && *mode != 6 {
+		return shape, fmt.Errorf("only triangles, triangle strips and fans are supported, mode is %d", *mode)
+	}
+	pos, ok := attributes["POSITION"]
+	if !ok {
+		return shape, fmt.Errorf("no POSITION")
+	}
+	p, err := g.accessor(pos, "VEC3")
+	if err != nil {
+		return shape, err
+	}
+	nVertices := len(p) / 3
+	for v := 0; v < nVertices; v++ {
+		shape.p = append(shape.p, core.Point3{X: p[3*v], Y: p[3*v+1], Z: p[3*v+2]})
+	}
+
+	var indices []int
+	if indicesAccessor != nil {
+		idx, err := g.accessor(*indicesAccessor, "SCALAR")
+		if err != nil {
+			return shape, err
+		}
+		// indices are unsigned bytes, shorts or ints
+		if ct := g.doc.Accessors[*indicesAccessor].ComponentType; ct != 5121 && ct != 5123 && ct != 5125 {
+			return shape, fmt.Errorf("index accessor %d has component type %d, expected an unsigned integer type",
+				*indicesAccessor, ct)
+		}
+		for _, v := range idx {
+			if v < 0 || v >= float64(nVertices) || v != math.Trunc(v) {
+				return shape, fmt.Errorf("vertex index %v out of range, %d vertices", v, nVertices)
+			}
+			indices = append(indices, int(v))
+		}
+	} else {
+		for v := 0; v < nVertices; v++ {
+			indices = append(indices, v)
+		}
+	}
+	switch {
+	case mode != nil && *mode == 5:
+		// strips alternate winding so every triangle faces the same way
+		for k := 0; k+2 < len(indices); k++ {
+			if k%2 == 0 {
+				shape.indices = append(shape.indices, indices[k], indices[k+1], indices[k+2])
+			} else {
+				shape.indices = append(shape.indices, indices[k+1], indices[k], indices[k+2])
+			}
+		}
+	case mode != nil && *mode == 6:
+		for k := 1; k+1 < len(indices); k++ {
+			shape.indices = append(shape.indices, indices[0], indices[k], indices[k+1])
+		}
+	default:
+		shape.indices = indices[:len(indices)-len(indices)%3]
+	}
+
+	// Optional vertex data, glTF has the texture origin at the top left
+	if a, ok := attributes["NORMAL"]; ok {
+		if n, err := g.accessor(a, "VEC3"); err == nil && len(n) == len(p) {
+			for v := 0; v < nVertices; v++ {
+				shape.n = append(shape.n, core.Normal3{X: n[3*v], Y: n[3*v+1], Z: n[3*v+2]})
+			}
+		} else {
+			b.warningf("bad NORMAL ignored: %v", gltfAttributeError(err))
+		}
+	}
+	if a, ok := attributes["TANGENT"]; ok {
+		if s, err := g.accessor(a, "VEC4"); err == nil && len(s) == 4*nVertices {
+			for v := 0; v < nVertices; v++ {
+				shape.s = append(shape.s, core.Vec3{X: s[4*v], Y: s[4*v+1], Z: s[4*v+2]})
+			}
+		} else {
+			b.warningf("bad TANGENT ignored: %v", gltfAttributeError(err))
+		}
+	}
+	if a, ok := attributes["TEXCOORD_0"]; ok {
+		if uv, err := g.accessor(a, "VEC2"); err == nil && len(uv) == 2*nVertices {
+			for v := 0; v < nVertices; v++ {
+				shape.uv = append(shape.uv, core.Point2{X: uv[2*v], Y: 1 - uv[2*v+1]})
+			}
+		} else {
+			b.warningf("bad TEXCOORD_0 ignored: %v", gltfAttributeError(err))
+		}
+	}
+	return shape, nil
+}
+
+// imagePath returns the file of a texture, embedded images can't be
+// referenced and give ""
+func (g *gltfFile) imagePath(tex *gltfTextureInfo) string {
+	if tex == nil || tex.Index < 0 || tex.Index >= len(g.doc.Textures) {
+		return ""
+	}
+	src := g.doc.Textures[tex.Index].Source
+	if src == nil || *src < 0 || *src >= len(g.doc.Images) {
+		return ""
+	}
+	uri := g.doc.Images[*src].URI
+	if uri == "" || strings.HasPrefix(uri, "data:") {
+		return ""
+	}
+	if path, err := url.PathUnescape(uri); err == nil {
+		uri = path
+	}
+	return resolvePath(g.filename, uri)
+}
+
+/*
+material maps a PBR metallic-roughness material onto "disney", which has the
+same base color, metallic and roughness parameters. A nil index gives the glTF
+default material. Normal, occlusion and emissive maps have no equivalent.
+*/
+func (sc *gltfScene) material(b *builder, i *int) *core.Material {
+	index := -1
+	if i != nil {
+		index = *i
+	}
+	if m, ok := sc.materials[index]; ok {
+		return m
+	}
+	g := sc.file
+	var gm gltfMaterial
+	if index >= 0 {
+		if index >= len(g.doc.Materials) {
+			b.warningf("material %d doesn't exist, using the default", index)
+		} else {
+			gm = g.doc.Materials[index]
+		}
+	}
+	pbr := &gm.PBRMetallicRoughness
+
+	params := core.NewParamSet()
+	textured := false
+	if tex := pbr.BaseColorTexture; tex != nil {
+		if path := g.imagePath(tex); path != "" {
+			params.AddStrings("color", "texture", []string{path})
+			textured = true
+		} else {
+			b.warningf("material %q: embedded base color texture ignored", gm.Name)
+		}
+	}
+	if !textured {
+		color := []float64{1, 1, 1}
+		if len(pbr.BaseColorFactor) >= 3 {
+			color = pbr.BaseColorFactor[:3]
+		}
+		params.AddFloats("color", "rgb", color)
+	}
+	metallic, roughness := 1.0, 1.0
+	if pbr.MetallicFactor != nil {
+		metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		roughness = *pbr.RoughnessFactor
+	}
+	params.AddFloats("metallic", "float", []float64{metallic})
+	params.AddFloats("roughness", "float", []float64{roughness})
+
+	var ignored []string
+	if pbr.MetallicRoughnessTexture != nil {
+		ignored = append(ignored, "metallicRoughnessTexture")
+	}
+	if gm.NormalTexture != nil {
+		ignored = append(ignored, "normalTexture")
+	}
+	if len(gm.EmissiveFactor) == 3 && (gm.EmissiveFactor[0] > 0 || gm.EmissiveFactor[1] > 0 || gm.EmissiveFactor[2] > 0) {
+		ignored = append(ignored, "emissiveFactor")
+	}
+	if len(ignored) > 0 {
+		b.warningf("material %q: %s not supported", gm.Name, strings.Join(ignored, ", "))
+	}
+	m := &core.Material{Desc: "disney", Params: params}
+	sc.materials[index] = m
+	return m
+}
+
+// gltfCamera keeps the first perspective camera. glTF cameras look down -z and
+// ours down +z so z is flipped
+func (b *builder) gltfCamera(sc *gltfScene, i int, toWorld core.Transform) {
+	g := sc.file
+	if i < 0 || i >= len(g.doc.Cameras) {
+		b.warningf("camera %d doesn't exist", i)
+		return
+	}
+	cam := g.doc.Cameras[i]
+	if cam.Type != "perspective" || cam.Perspective == nil {
+		b.warningf("%s camera %d ignored, only perspective cameras are supported", cam.Type, i)
+		return
+	}
+	if sc.hasCamera {
+		sc.ignoredCameras++
+		return
+	}
+	sc.hasCamera = true
+	sc.cameraToWorld = core.ConcatTransforms(toWorld, core.Scale(1, 1, -1))
+
+	// yfov is vertical, fov is for the shorter image axis
+	fov := cam.Perspective.Yfov
+	if cam.Perspective.AspectRatio != nil {
+		sc.aspectRatio = *cam.Perspective.AspectRatio
+		if sc.aspectRatio < 1 {
+			fov = 2 * math.Atan(math.Tan(fov/2)*sc.aspectRatio)
+		}
+	}
+	sc.cameraParams = core.NewParamSet()
+	sc.cameraParams.AddFloats("fov", "float", []float64{core.Degress(fov)})
+}
+
+// gltfLight maps KHR_lights_punctual lights onto distant, point and spot lights,
+// they all shine down -z
+func (b *builder) gltfLight(sc *gltfScene, i int, toWorld core.Transform) {
+	g := sc.file
+	lights := g.doc.Extensions.LightsPunctual.Lights
+	if i < 0 || i >= len(lights) {
+		b.warningf("light %d doesn't exist", i)
+		return
+	}
+	l := lights[i]
+	color := []float64{1, 1, 1}
+	if len(l.Color) == 3 {
+		color = append([]float64(nil), l.Color...)
+	}
+	if l.Intensity != nil {
+		for c := range color {
+			color[c] *= *l.Intensity
+		}
+	}
+
+	params := core.NewParamSet()
+	params.AddFloats("from", "point", []float64{0, 0, 0})
+	var name string
+	switch l.Type {
+	case "directional":
+		name = "distant"
+		params.AddFloats("L", "rgb", color)
+		params.AddFloats("to", "point", []float64{0, 0, -1})
+	case "point":
+		name = "point"
+		params.AddFloats("I", "rgb", color)
+	case "spot":
+		name = "spot"
+		inner, outer := 0.0, math.Pi/4
+		if l.Spot != nil {
+			inner = l.Spot.InnerConeAngle
+			if l.Spot.OuterConeAngle != nil {
+				outer = *l.Spot.OuterConeAngle
+			}
+		}
+		params.AddFloats("I", "rgb", color)
+		params.AddFloats("to", "point", []float64{0, 0, -1})
+		params.AddFloats("coneangle", "float", []float64{core.Degress(outer)})
+		params.AddFloats("conedeltaangle", "float", []float64{core.Degress(outer - inner)})
+	default:
+		b.warningf("light type %q unknown", l.Type)
+		return
+	}
+	sc.lights = append(sc.lights, LightDesc{name, params, toWorld})
+}
+
+/*
+ImportGLTF makes a scene out of a glTF 2.0 file (.gltf or .glb): the meshes of
+its default scene, its first perspective camera and its punctual lights. Like
+ImportOBJ a camera framing the model and an infinite light are added when the
+file has none.
+*/
+func ImportGLTF(filename string) bool {
+	if api == nil {
+		api = newBuilder()
+	}
+	b := api
+	errs := b.diags.Errors()
+	b.directive = token{loc: system.Loc{Filename: filename}}
+	g, err := readGLTF(filename)
+	if err != nil {
+		b.errorf("couldn't read glTF file: %v", err)
+		return false
+	}
+	sc := b.gltfScene(g)
+
+	if sc.hasCamera {
+		if sc.aspectRatio > 0 {
+			// keep the default film height and match the camera's aspect ratio
+			const yRes = 720
+			filmParams := core.NewParamSet()
+			filmParams.AddFloats("xresolution", "integer", []float64{math.Round(yRes * sc.aspectRatio)})
+			filmParams.AddFloats("yresolution", "integer", []float64{yRes})
+			b.film("image", filmParams)
+		}
+		worldToCamera := sc.cameraToWorld.Inverse()
+		b.ctm = transformSet{worldToCamera, worldToCamera}
+		b.camera("perspective", sc.cameraParams)
+	} else {
+		b.frameCamera(sc.bounds)
+	}
+
+	b.worldBegin()
+	if len(sc.lights) == 0 {
+		b.lightSource("infinite", core.NewParamSet())
+	}
+	for _, l := range sc.lights {
+		b.ctm = transformSet{l.LightToWorld, l.LightToWorld}
+		b.lightSource(l.Name, l.Params)
+	}
+	for _, s := range sc.shapes {
+		objToWorld, worldToObj := b.transforms.lookup(s.toWorld)
+		b.addShapes(core.CreateTriangleMesh(objToWorld, worldToObj, false, s.indices, s.p, s.s, s.n, s.uv),
+			s.material)
+	}
+	b.worldEnd()
+	return b.diags.Errors() == errs
+}
@@ -0,0 +1,237 @@
+package parser
+
+import (
+	"Anvil/core"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// glb assembles a binary glTF file, length is the total length written in the
+// header, 0 for the real one
+func glb(version, length uint32, chunks ...[]byte) []byte {
+	var body []byte
+	for i := 0; i+1 < len(chunks); i += 2 {
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(chunks[i+1])))
+		body = append(body, chunks[i]...)
+		body = append(body, chunks[i+1]...)
+	}
+	if length == 0 {
+		length = uint32(12 + len(body))
+	}
+	data := binary.LittleEndian.AppendUint32(nil, glbMagic)
+	data = binary.LittleEndian.AppendUint32(data, version)
+	data = binary.LittleEndian.AppendUint32(data, length)
+	return append(data, body...)
+}
+
+func TestReadGLBChunks(t *testing.T) {
+	chunkType := func(t uint32) []byte { return binary.LittleEndian.AppendUint32(nil, t) }
+	jsonChunk, binChunk, other := chunkType(glbChunkJSON), chunkType(glbChunkBIN), chunkType(0x12345678)
+	js, bin := []byte(`{"a":1}`), []byte{1, 2, 3, 4}
+	// the header length covers the file but the chunk claims more than is left
+	overrun := glb(2, 0, jsonChunk, js)
+	overrun = overrun[:len(overrun)-4]
+	binary.LittleEndian.PutUint32(overrun[8:], uint32(len(overrun)))
+	tests := []struct {
+		name      string
+		data      []byte
+		json, bin []byte
+		err       string
+	}{
+		{"json only", glb(2, 0, jsonChunk, js), js, nil, ""},
+		{"json and bin", glb(2, 0, jsonChunk, js, binChunk, bin), js, bin, ""},
+		{"bin first", glb(2, 0, binChunk, bin, jsonChunk, js), js, bin, ""},
+		{"unknown chunk skipped", glb(2, 0, jsonChunk, js, other, []byte{9, 9}, binChunk, bin), js, bin, ""},
+		{"only the first bin", glb(2, 0, jsonChunk, js, binChunk, bin, binChunk, []byte{5}), js, bin, ""},
+		{"version 1", glb(1, 0, jsonChunk, js), nil, nil, "version 1"},
+		{"truncated", glb(2, 100, jsonChunk, js), nil, nil, "truncated"},
+		{"chunk overrun", overrun, nil, nil, "overruns"},
+		{"no json", glb(2, 0, binChunk, bin), nil, nil, "no JSON chunk"},
+	}
+	for _, test := range tests {
+		js, bin, err := readGLBChunks(test.data)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, expected %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(js, test.json) || !reflect.DeepEqual(bin, test.bin) {
+			t.Errorf("%s: got %q %v %v, expected %q %v", test.name, js, bin, err, test.json, test.bin)
+		}
+	}
+}
+
+func TestGLTFAccessor(t *testing.T) {
+	// three interleaved vertices of a float VEC2 and a padding float, then bytes
+	var buf []byte
+	for _, f := range []float32{1, 2, 0, 3, 4, 0, 5, 6, 0} {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(f))
+	}
+	buf = append(buf, 255, 0, 0x80, 0x7f)
+	view := func(i int) *int { return &i }
+	g := &gltfFile{buffers: [][]byte{buf}}
+	g.doc.BufferViews = []gltfBufferView{
+		{Buffer: 0, ByteOffset: 0, ByteLength: 36, ByteStride: 12},
+		{Buffer: 0, ByteOffset: 36, ByteLength: 4},
+		{Buffer: 0, ByteOffset: 36, ByteLength: 8},
+		{Buffer: 1, ByteLength: 4},
+	}
+	g.doc.Accessors = []gltfAccessor{
+		{BufferView: view(0), ComponentType: 5126, Count: 3, Type: "VEC2"},
+		{BufferView: view(1), ComponentType: 5121, Count: 2, Type: "SCALAR", Normalized: true},
+		{BufferView: view(1), ByteOffset: 2, ComponentType: 5120, Count: 2, Type: "SCALAR", Normalized: true},
+		{BufferView: view(0), ComponentType: 5126, Count: 4, Type: "VEC2"},
+		{BufferView: view(0), ByteOffset: 8, ComponentType: 5126, Count: 3, Type: "VEC2"},
+		{BufferView: view(2), ComponentType: 5121, Count: 8, Type: "SCALAR"},
+		{BufferView: view(3), ComponentType: 5121, Count: 1, Type: "SCALAR"},
+		{BufferView: view(7), ComponentType: 5121, Count: 1, Type: "SCALAR"},
+		{ComponentType: 5121, Count: 1, Type: "SCALAR"},
+		{BufferView: view(1), ComponentType: 5124, Count: 1, Type: "SCALAR"},
+	}
+	tests := []struct {
+		accessor int
+		typ      string
+		values   []float64
+		err      string
+	}{
+		{0, "VEC2", []float64{1, 2, 3, 4, 5, 6}, ""},
+		{1, "SCALAR", []float64{1, 0}, ""},
+		{2, "SCALAR", []float64{-1, 1}, ""},
+		{0, "VEC3", nil, "expected VEC3"},
+		{3, "VEC2", nil, "overruns"},
+		{4, "VEC2", nil, "overruns"},
+		{5, "SCALAR", nil, "overruns"},
+		{6, "SCALAR", nil, "buffer 1 doesn't exist"},
+		{7, "SCALAR", nil, "buffer view 7 doesn't exist"},
+		{8, "SCALAR", nil, "sparse"},
+		{9, "SCALAR", nil, "unknown component type"},
+		{10, "SCALAR", nil, "accessor 10 doesn't exist"},
+		{-1, "SCALAR", nil, "doesn't exist"},
+	}
+	for _, test := range tests {
+		values, err := g.accessor(test.accessor, test.typ)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("accessor %d: got error %v, expected %q", test.accessor, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("accessor %d: got %v %v, expected %v", test.accessor, values, err, test.values)
+		}
+	}
+}
+
+func nearP(a, b core.Point3) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 && math.Abs(a.Z-b.Z) < 1e-9
+}
+
+// nodes scale, then rotate, then translate
+func TestGLTFNodeTransform(t *testing.T) {
+	s := math.Sqrt(0.5)
+	trs := &gltfNode{Translation: []float64{1, 2, 3}, Rotation: []float64{0, 0, s, s}, Scale: []float64{2, 2, 2}}
+	matrix := &gltfNode{Matrix: []float64{0, 2, 0, 0, -2, 0, 0, 0, 0, 0, 2, 0, 1, 2, 3, 1}}
+	for name, node := range map[string]*gltfNode{"trs": trs, "matrix": matrix} {
+		tr := gltfNodeTransform(node)
+		if p := tr.ApplyP(core.Point3{X: 1}); !nearP(p, core.Point3{X: 1, Y: 4, Z: 3}) {
+			t.Errorf("%s: (1, 0, 0) goes to %v, expected (1, 4, 3)", name, p)
+		}
+		if p := tr.ApplyP(core.Point3{Z: 1}); !nearP(p, core.Point3{X: 1, Y: 2, Z: 5}) {
+			t.Errorf("%s: (0, 0, 1) goes to %v, expected (1, 2, 5)", name, p)
+		}
+	}
+	if tr := gltfNodeTransform(&gltfNode{}); !core.IsEqualTransform(tr, core.NewTransform()) {
+		t.Errorf("empty node isn't the identity")
+	}
+}
+
+func TestGLTFScene(t *testing.T) {
+	for _, file := range []string{"scene.gltf", "scene.glb"} {
+		g, err := readGLTF("testdata/gltf/" + file)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		b := newBuilder()
+		b.diags.Quiet = true
+		sc := b.gltfScene(g)
+
+		if len(sc.shapes) != 1 {
+			t.Fatalf("%s: %d shapes, expected 1", file, len(sc.shapes))
+		}
+		shape := sc.shapes[0]
+		if !reflect.DeepEqual(shape.indices, []int{0, 1, 2, 0, 2, 3}) || len(shape.p) != 4 {
+			t.Errorf("%s: indices %v and %d vertices", file, shape.indices, len(shape.p))
+		}
+		if p := shape.toWorld.ApplyP(shape.p[1]); !nearP(p, core.Point3{X: 1, Y: 4, Z: 3}) {
+			t.Errorf("%s: vertex 1 is at %v, expected (1, 4, 3)", file, p)
+		}
+
+		// the camera is a child of the rotated node, 10 up its z and looking down
+		// it once flipped to our +z
+		if !sc.hasCamera || sc.aspectRatio != 1.5 {
+			t.Fatalf("%s: camera %v with aspect ratio %v", file, sc.hasCamera, sc.aspectRatio)
+		}
+		if p := sc.cameraToWorld.ApplyP(core.Point3{}); !nearP(p, core.Point3{X: 1, Y: 2, Z: 23}) {
+			t.Errorf("%s: camera at %v, expected (1, 2, 23)", file, p)
+		}
+		if fov := sc.cameraParams.FindOneFloat("fov", 0); math.Abs(fov-core.Degress(0.8)) > 1e-9 {
+			t.Errorf("%s: fov %v, expected %v", file, fov, core.Degress(0.8))
+		}
+
+		// node 4 has node 3 as its child, which is its own parent
+		if len(sc.lights) != 2 {
+			t.Fatalf("%s: %d lights, expected 2", file, len(sc.lights))
+		}
+		cycles := 0
+		for _, d := range b.diags.All() {
+			if strings.Contains(d.Message, "its own ancestor") {
+				cycles++
+			}
+		}
+		if cycles != 1 {
+			t.Errorf("%s: %d cycle warnings, expected 1", file, cycles)
+		}
+		spot, point := sc.lights[0], sc.lights[1]
+		if spot.Name != "spot" || point.Name != "point" {
+			t.Fatalf("%s: lights %q and %q, expected spot and point", file, spot.Name, point.Name)
+		}
+		if c := spot.Params.FindOneFloat("coneangle", 0); math.Abs(c-core.Degress(0.5)) > 1e-9 {
+			t.Errorf("%s: cone angle %v, expected %v", file, c, core.Degress(0.5))
+		}
+		if d := spot.Params.FindOneFloat("conedeltaangle", 0); math.Abs(d-core.Degress(0.3)) > 1e-9 {
+			t.Errorf("%s: cone delta angle %v, expected %v", file, d, core.Degress(0.3))
+		}
+		if i := spot.Params.FindOneSpectrum("I", nil); !reflect.DeepEqual(i, []float64{2, 1, 0.5}) {
+			t.Errorf("%s: spot intensity %v, expected [2 1 0.5]", file, i)
+		}
+		if i := point.Params.FindOneSpectrum("I", nil); !reflect.DeepEqual(i, []float64{1, 1, 1}) {
+			t.Errorf("%s: point intensity %v, expected [1 1 1]", file, i)
+		}
+	}
+}
+
+// primitives with signed or out of range indices are skipped with a warning
+func TestGLTFBadIndices(t *testing.T) {
+	g, err := readGLTF("testdata/gltf/bad_indices.gltf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBuilder()
+	b.diags.Quiet = true
+	sc := b.gltfScene(g)
+	if len(sc.shapes) != 1 {
+		t.Errorf("%d shapes, expected only the valid primitive", len(sc.shapes))
+	}
+	var warnings []string
+	for _, d := range b.diags.All() {
+		warnings = append(warnings, d.Message)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "component type 5120") ||
+		!strings.Contains(warnings[1], "vertex index 4 out of range") {
+		t.Errorf("warnings %q", warnings)
+	}
+}
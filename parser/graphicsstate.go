@@ -0,0 +1,211 @@
+package parser
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"Anvil/system"
+)
+
+// attributes that are applied to every shape declared while they are active,
+// AttributeBegin/AttributeEnd save and restore them along with the CTM
+type graphicsState struct {
+	material           *core.Material
+	areaLightName      string
+	areaLightParams    core.ParamSet
+	reverseOrientation bool
+	// names of media made with MakeNamedMedium, empty for vacuum
+	currentInsideMedium, currentOutsideMedium string
+}
+
+func newGraphicsState() graphicsState {
+	return graphicsState{material: &core.Material{Desc: "matte"}}
+}
+
+// kinds of scope that can be open, used to catch mismatched Begin/End pairs
+type scopeKind int
+
+const (
+	scopeAttribute scopeKind = iota
+	scopeTransform
+	// ObjectBegin implicitly saves the attributes like AttributeBegin
+	scopeObject
+)
+
+func (k scopeKind) String() string {
+	switch k {
+	case scopeAttribute:
+		return "AttributeBegin"
+	case scopeTransform:
+		return "TransformBegin"
+	default:
+		return "ObjectBegin"
+	}
+}
+
+type scope struct {
+	kind scopeKind
+	loc  system.Loc
+}
+
+// transformCache hands out one pointer per distinct transform so that shapes
+// sharing a CTM also share their ObjectToWorld/WorldToObject pair
+type transformCache map[core.Transform]*core.Transform
+
+func (c transformCache) lookup(t core.Transform) (*core.Transform, *core.Transform) {
+	tr, ok := c[t]
+	if !ok {
+		tr = &t
+		c[t] = tr
+	}
+	inv := t.Inverse()
+	trInv, ok := c[inv]
+	if !ok {
+		trInv = &inv
+		c[inv] = trInv
+	}
+	return tr, trInv
+}
+
+// ---------- scope directives ----------
+
+func (b *builder) attributeBegin() {
+	if b.verifyWorld() {
+		b.pushAttributes(scopeAttribute)
+	}
+}
+
+func (b *builder) attributeEnd() {
+	if b.verifyWorld() {
+		b.popAttributes(scopeAttribute)
+	}
+}
+
+func (b *builder) pushAttributes(kind scopeKind) {
+	b.pushedGraphicsStates = append(b.pushedGraphicsStates, b.gs)
+	b.pushedTransforms = append(b.pushedTransforms, b.ctm)
+	b.pushedActiveBits = append(b.pushedActiveBits, b.activeTransformBits)
+	b.scopes = append(b.scopes, scope{kind, b.directive.loc})
+}
+
+func (b *builder) popAttributes(kind scopeKind) bool {
+	if !b.popScope(kind) {
+		return false
+	}
+	last := len(b.pushedGraphicsStates) - 1
+	b.gs = b.pushedGraphicsStates[last]
+	b.pushedGraphicsStates = b.pushedGraphicsStates[:last]
+	b.popTransform()
+	return true
+}
+
+func (b *builder) transformBegin() {
+	if !b.verifyWorld() {
+		return
+	}
+	b.pushedTransforms = append(b.pushedTransforms, b.ctm)
+	b.pushedActiveBits = append(b.pushedActiveBits, b.activeTransformBits)
+	b.scopes = append(b.scopes, scope{scopeTransform, b.directive.loc})
+}
+
+func (b *builder) transformEnd() {
+	if !b.verifyWorld() {
+		return
+	}
+	if !b.popScope(scopeTransform) {
+		return
+	}
+	b.popTransform()
+}
+
+func (b *builder) popTransform() {
+	last := len(b.pushedTransforms) - 1
+	b.ctm, b.activeTransformBits = b.pushedTransforms[last], b.pushedActiveBits[last]
+	b.pushedTransforms, b.pushedActiveBits = b.pushedTransforms[:last], b.pushedActiveBits[:last]
+}
+
+// popScope checks that the innermost open scope is of the given kind and removes
+// it, an End without a matching Begin is ignored
+func (b *builder) popScope(kind scopeKind) bool {
+	if len(b.scopes) == 0 {
+		b.warningf("unmatched %s encountered, ignoring it", b.directive.text)
+		return false
+	}
+	top := b.scopes[len(b.scopes)-1]
+	if top.kind != kind {
+		b.warningf("%s closes the %s opened at %v", b.directive.text, top.kind, top.loc)
+		return false
+	}
+	b.scopes = b.scopes[:len(b.scopes)-1]
+	return true
+}
+
+// closeScopes is called at WorldEnd to unwind anything left open
+func (b *builder) closeScopes() {
+	for i := len(b.scopes) - 1; i >= 0; i-- {
+		b.warningf("missing end to %s opened at %v", b.scopes[i].kind, b.scopes[i].loc)
+	}
+	b.scopes = nil
+	b.pushedGraphicsStates = nil
+	b.pushedTransforms = nil
+	b.pushedActiveBits = nil
+	b.currentInstance, b.inInstance = "", false
+}
+
+// ---------- named coordinate systems ----------
+
+func (b *builder) coordinateSystem(name string) {
+	b.namedCoordinateSystems[name] = b.ctm
+}
+
+func (b *builder) coordSysTransform(name string) {
+	if t, ok := b.namedCoordinateSystems[name]; ok {
+		b.ctm = t
+	} else {
+		b.warningf("couldn't find named coordinate system %q", name)
+	}
+}
+
+// ---------- graphics state directives ----------
+
+func (b *builder) reverseOrientation() {
+	if b.verifyWorld() {
+		b.gs.reverseOrientation = !b.gs.reverseOrientation
+	}
+}
+
+func (b *builder) makeNamedMedium(name string, params core.ParamSet) {
+	if _, ok := b.opts.NamedMedia[name]; ok {
+		b.warningf("named medium %q redefined", name)
+	}
+	typ := params.FindOneString("type", "")
+	if typ == "" {
+		b.errorf("no parameter string \"type\" found in MakeNamedMedium")
+		return
+	}
+	b.opts.NamedMedia[name] = &media.Medium{Desc: typ}
+}
+
+func (b *builder) mediumInterface(inside, outside string) {
+	b.gs.currentInsideMedium = inside
+	b.gs.currentOutsideMedium = outside
+}
+
+// currentMediumInterface resolves the medium names in the graphics state
+func (b *builder) currentMediumInterface() (media.MediumInterface, bool) {
+	find := func(name string) (*media.Medium, bool) {
+		if name == "" {
+			return nil, true
+		}
+		m, ok := b.opts.NamedMedia[name]
+		if !ok {
+			b.errorf("named medium %q undefined", name)
+		}
+		return m, ok
+	}
+	inside, okIn := find(b.gs.currentInsideMedium)
+	if b.gs.currentOutsideMedium == b.gs.currentInsideMedium {
+		return media.NewMediumInterface(inside, inside), okIn
+	}
+	outside, okOut := find(b.gs.currentOutsideMedium)
+	return media.NewMediumInterface(inside, outside), okIn && okOut
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"Anvil/core"
+	"Anvil/media"
+	"Anvil/system"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath makes a path from a scene file relative to the directory of the
+// file that references it, files read from standard input are relative to the
+// working directory
+func resolvePath(including, filename string) string {
+	if filepath.IsAbs(filename) || including == "-" {
+		return filename
+	}
+	return filepath.Join(filepath.Dir(including), filename)
+}
+
+// key used to recognize the same file reached through different relative paths
+func fileKey(filename string) string {
+	if filename == "-" {
+		return filename
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
+
+// parseFile runs the parser over a file with this builder, loc is where the file
+// was referenced from and is used to report files that can't be read or that
+// would include themselves. Returns false if the file couldn't be parsed at all
+func (b *builder) parseFile(filename string, loc system.Loc, token string) bool {
+	key := fileKey(filename)
+	for i, f := range b.files {
+		if f == key {
+			chain := append(append([]string(nil), b.files[i:]...), key)
+			b.diags.Errorf(loc, token, "include cycle: %s", strings.Join(chain, " -> "))
+			return false
+		}
+	}
+	t, err := newTokenizer(filename)
+	if err != nil {
+		b.diags.Fatalf(loc, token, "couldn't open scene file: %v", err)
+		return false
+	}
+
+	b.files = append(b.files, key)
+	p := &sceneParser{t: t, b: b, diags: b.diags}
+	p.parse()
+	b.files = b.files[:len(b.files)-1]
+	// included files may leave the world block open, a scene file may not
+	if len(b.files) == 0 && !b.imported && b.state == stateWorldBlock {
+		b.diags.Errorf(t.loc(), "", "missing WorldEnd at end of file")
+	}
+	return true
+}
+
+// include parses another file in place, it shares all of the current state
+func (b *builder) include(filename string) {
+	directive := b.directive
+	b.parseFile(resolvePath(directive.loc.Filename, filename), directive.loc, directive.text)
+	b.directive = directive
+}
+
+// importJob is an imported file being parsed by its own builder
+type importJob struct {
+	b    *builder
+	done chan struct{}
+}
+
+/*
+importFile parses another file concurrently. The imported file starts with a copy
+of the current transform, graphics state, named media and coordinate systems but
+any changes it makes to them stay local to it, only its shapes and lights are
+kept. Those are merged back in order at WorldEnd so the result doesn't depend on
+which import finishes first. Imports aren't allowed inside an object
+definition since the object has to be complete when it's instanced.
+*/
+func (b *builder) importFile(filename string) {
+	if !b.verifyWorld() {
+		return
+	}
+	if b.inInstance {
+		b.errorf("Import can't be called inside instance definition, use Include")
+		return
+	}
+	directive := b.directive
+	path := resolvePath(directive.loc.Filename, filename)
+
+	child := &builder{
+		state:               stateWorldBlock,
+		ctm:                 b.ctm,
+		activeTransformBits: b.activeTransformBits,
+		gs:                  b.gs,
+		opts: &RenderOptions{
+			NamedMedia:         map[string]*media.Medium{},
+			Instances:          map[string][]core.Primitive{},
+			accel:              b.opts.accel,
+			TransformStartTime: b.opts.TransformStartTime,
+			TransformEndTime:   b.opts.TransformEndTime,
+		},
+		diags:   b.diags,
+		options: b.options,
+
+		namedCoordinateSystems: map[string]transformSet{},
+		transforms:             transformCache{},
+		files:                  append([]string(nil), b.files...),
+		imported:               true,
+		sem:                    b.importSemaphore(),
+	}
+	for k, v := range b.opts.NamedMedia {
+		child.opts.NamedMedia[k] = v
+	}
+	for k, v := range b.namedCoordinateSystems {
+		child.namedCoordinateSystems[k] = v
+	}
+
+	job := &importJob{child, make(chan struct{})}
+	b.imports = append(b.imports, job)
+	go func() {
+		child.sem <- struct{}{}
+		child.parseFile(path, directive.loc, directive.text)
+		<-child.sem
+		// nested imports don't hold a slot while they wait for their own imports
+		child.waitImports()
+		close(job.done)
+	}()
+}
+
+// limits how many imported files are parsed at once
+func (b *builder) importSemaphore() chan struct{} {
+	if b.sem == nil {
+		b.sem = make(chan struct{}, b.options.Threads())
+	}
+	return b.sem
+}
+
+// waitImports blocks until every pending import is parsed and adds what they
+// declared to this builder's render options
+func (b *builder) waitImports() {
+	for _, job := range b.imports {
+		<-job.done
+		b.opts.Primitives = append(b.opts.Primitives, job.b.opts.Primitives...)
+		b.opts.Lights = append(b.opts.Lights, job.b.opts.Lights...)
+		for name, prims := range job.b.opts.Instances {
+			if _, ok := b.opts.Instances[name]; ok {
+				b.warningf("object %q redefined by an imported file", name)
+			}
+			b.opts.Instances[name] = prims
+		}
+		b.instanceUses = append(b.instanceUses, job.b.instanceUses...)
+	}
+	b.imports = nil
+}
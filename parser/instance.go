@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"Anvil/core"
+)
+
+// instanceUse is an ObjectInstance waiting for WorldEnd, instances are resolved
+// once every imported file is done so they can refer to objects defined anywhere
+type instanceUse struct {
+	name            string
+	directive       token
+	instanceToWorld transformSet
+}
+
+func (b *builder) objectBegin(name string) {
+	if !b.verifyWorld() {
+		return
+	}
+	if b.inInstance {
+		b.errorf("ObjectBegin called inside of instance definition")
+		return
+	}
+	b.pushAttributes(scopeObject)
+	if _, ok := b.opts.Instances[name]; ok {
+		b.warningf("object %q redefined", name)
+	}
+	b.opts.Instances[name] = []core.Primitive{}
+	b.currentInstance, b.inInstance = name, true
+}
+
+func (b *builder) objectEnd() {
+	if !b.verifyWorld() {
+		return
+	}
+	if !b.inInstance {
+		b.errorf("ObjectEnd called outside of instance definition")
+		return
+	}
+	if b.popAttributes(scopeObject) {
+		b.currentInstance, b.inInstance = "", false
+	}
+}
+
+func (b *builder) objectInstance(name string) {
+	if !b.verifyWorld() {
+		return
+	}
+	if b.inInstance {
+		b.errorf("ObjectInstance can't be called inside instance definition")
+		return
+	}
+	b.instanceUses = append(b.instanceUses, instanceUse{name, b.directive, b.ctm})
+}
+
+// resolveInstances turns every ObjectInstance into a primitive placed with the
+// transform that was current when it was declared, instances made of more than
+// one primitive share a single aggregate built the first time they are used
+func (b *builder) resolveInstances() {
+	aggregates := map[string]core.Primitive{}
+	for _, use := range b.instanceUses {
+		prims, ok := b.opts.Instances[use.name]
+		if !ok {
+			b.diags.Errorf(use.directive.loc, use.directive.text, "unable to find instance named %q", use.name)
+			continue
+		}
+		if len(prims) == 0 {
+			continue
+		}
+		prim, ok := aggregates[use.name]
+		if !ok {
+			prim = prims[0]
+			if len(prims) > 1 {
+				prim = b.opts.accel.build(prims, b.options.Threads())
+			}
+			aggregates[use.name] = prim
+		}
+		b.opts.Primitives = append(b.opts.Primitives,
+			core.NewTransformedPrimitive(prim, b.animatedTransform(use.instanceToWorld)))
+	}
+	b.instanceUses = nil
+}
@@ -0,0 +1,456 @@
+package parser
+
+import (
+	"Anvil/core"
+	"Anvil/system"
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// objMesh is the faces of one group of an OBJ file that use the same material,
+// it becomes one triangle mesh. n and uv are nil unless every vertex has them
+type objMesh struct {
+	group, material string
+	p               []core.Point3
+	n               []core.Normal3
+	uv              []core.Point2
+	indices         []int
+
+	// mesh vertex of each v/vt/vn combination
+	vertices                   map[[3]int]int
+	missingNormals, missingUVs bool
+}
+
+type objWarning struct {
+	loc system.Loc
+	msg string
+}
+
+// objFile is what was read from an OBJ file and the MTL files it references
+type objFile struct {
+	meshes    []*objMesh
+	materials map[string]*core.Material
+	warnings  []objWarning
+}
+
+func (o *objFile) warnf(loc system.Loc, format string, a ...interface{}) {
+	o.warnings = append(o.warnings, objWarning{loc, fmt.Sprintf(format, a...)})
+}
+
+// objReader holds the state of the OBJ parse, face indices refer to the
+// positions, uvs and normals declared so far
+type objReader struct {
+	file     *objFile
+	filename string
+	p        []core.Point3
+	uv       []core.Point2
+	n        []core.Normal3
+
+	group, material string
+	meshes          map[[2]string]*objMesh
+	current         *objMesh
+}
+
+// readOBJ loads the polygons of an OBJ file as triangle meshes, one per group and
+// material. Polygons with more than three vertices are triangulated as fans
+func readOBJ(filename string) (*objFile, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &objReader{
+		file:     &objFile{materials: map[string]*core.Material{}},
+		filename: filename,
+		meshes:   map[[2]string]*objMesh{},
+	}
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		loc := system.Loc{Filename: filename, Line: line, Column: 1}
+		if err := r.parseLine(loc, s.Text()); err != nil {
+			return nil, fmt.Errorf("%v: %v", loc, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range r.file.meshes {
+		if m.missingNormals {
+			m.n = nil
+		}
+		if m.missingUVs {
+			m.uv = nil
+		}
+		m.vertices = nil
+	}
+	return r.file, nil
+}
+
+func (r *objReader) parseLine(loc system.Loc, line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "v":
+		v, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		r.p = append(r.p, core.Point3{X: v[0], Y: v[1], Z: v[2]})
+	case "vt":
+		v, err := parseFloats(args, 2)
+		if err != nil {
+			return err
+		}
+		r.uv = append(r.uv, core.Point2{X: v[0], Y: v[1]})
+	case "vn":
+		v, err := parseFloats(args, 3)
+		if err != nil {
+			return err
+		}
+		r.n = append(r.n, core.Normal3{X: v[0], Y: v[1], Z: v[2]})
+	case "f":
+		return r.face(args)
+	case "g", "o":
+		r.group = strings.Join(args, " ")
+		r.current = nil
+	case "usemtl":
+		r.material = strings.Join(args, " ")
+		if _, ok := r.file.materials[r.material]; !ok {
+			r.file.warnf(loc, "material %q not defined in any mtllib", r.material)
+		}
+		r.current = nil
+	case "mtllib":
+		for _, name := range args {
+			path := resolvePath(r.filename, name)
+			if err := readMTL(path, r.file); err != nil {
+				r.file.warnf(loc, "couldn't read material library: %v", err)
+			}
+		}
+	case "s", "l", "p", "cstype", "deg", "curv", "surf", "parm", "end":
+		// smoothing groups and free form geometry aren't supported
+	default:
+		r.file.warnf(loc, "unknown OBJ statement %q ignored", fields[0])
+	}
+	return nil
+}
+
+func parseFloats(args []string, n int) ([]float64, error) {
+	if len(args) < n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(args))
+	}
+	v := make([]float64, n)
+	for i := range v {
+		var err error
+		if v[i], err = strconv.ParseFloat(args[i], 64); err != nil {
+			return nil, fmt.Errorf("bad number %q", args[i])
+		}
+	}
+	return v, nil
+}
+
+// objIndex turns a 1 based, possibly negative (relative to the end), index into
+// an index in a list of n elements
+func objIndex(s string, n int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad index %q", s)
+	}
+	if i < 0 {
+		i += n
+	} else {
+		i--
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("index %s out of range, %d defined", s, n)
+	}
+	return i, nil
+}
+
+func (r *objReader) face(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("face with %d vertices", len(args))
+	}
+	m := r.mesh()
+	verts := make([]int, len(args))
+	for i, arg := range args {
+		// v, v/vt, v//vn or v/vt/vn, -1 for the missing ones
+		key := [3]int{-1, -1, -1}
+		parts := strings.Split(arg, "/")
+		if len(parts) > 3 {
+			return fmt.Errorf("bad face vertex %q", arg)
+		}
+		lists := [3]int{len(r.p), len(r.uv), len(r.n)}
+		for j, part := range parts {
+			if part == "" && j > 0 {
+				continue
+			}
+			idx, err := objIndex(part, lists[j])
+			if err != nil {
+				return err
+			}
+			key[j] = idx
+		}
+
+		v, ok := m.vertices[key]
+		if !ok {
+			v = len(m.p)
+			m.vertices[key] = v
+			m.p = append(m.p, r.p[key[0]])
+			var uv core.Point2
+			if key[1] >= 0 {
+				uv = r.uv[key[1]]
+			} else {
+				m.missingUVs = true
+			}
+			m.uv = append(m.uv, uv)
+			var n core.Normal3
+			if key[2] >= 0 {
+				n = r.n[key[2]]
+			} else {
+				m.missingNormals = true
+			}
+			m.n = append(m.n, n)
+		}
+		verts[i] = v
+	}
+	for i := 1; i+1 < len(verts); i++ {
+		m.indices = append(m.indices, verts[0], verts[i], verts[i+1])
+	}
+	return nil
+}
+
+// mesh returns the mesh for the current group and material
+func (r *objReader) mesh() *objMesh {
+	if r.current != nil {
+		return r.current
+	}
+	key := [2]string{r.group, r.material}
+	m, ok := r.meshes[key]
+	if !ok {
+		m = &objMesh{group: r.group, material: r.material, vertices: map[[3]int]int{}}
+		r.meshes[key] = m
+		r.file.meshes = append(r.file.meshes, m)
+	}
+	r.current = m
+	return m
+}
+
+// mtlMaterial is the part of an MTL entry that can be mapped to our materials
+type mtlMaterial struct {
+	kd, ks             []float64
+	ns, ni, d          float64
+	illum              int
+	mapKd, mapKs, bump string
+}
+
+// readMTL adds the materials of an MTL file to o, texture maps are relative to it
+func readMTL(filename string, o *objFile) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var name string
+	var cur *mtlMaterial
+	flush := func() {
+		if cur != nil {
+			o.materials[name] = cur.toMaterial()
+		}
+	}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		loc := system.Loc{Filename: filename, Line: line, Column: 1}
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "newmtl" {
+			flush()
+			name = strings.Join(fields[1:], " ")
+			cur = &mtlMaterial{ni: 1.5, d: 1, illum: 2}
+			continue
+		}
+		if cur == nil {
+			o.warnf(loc, "%q before any newmtl ignored", fields[0])
+			continue
+		}
+		// texture maps may have options before the file name, which is last
+		mapFile := func() string {
+			return resolvePath(filename, fields[len(fields)-1])
+		}
+		var err error
+		switch strings.ToLower(fields[0]) {
+		case "kd":
+			cur.kd, err = parseFloats(fields[1:], 3)
+		case "ks":
+			cur.ks, err = parseFloats(fields[1:], 3)
+		case "ns":
+			err = parseFloat(fields[1:], &cur.ns)
+		case "ni":
+			err = parseFloat(fields[1:], &cur.ni)
+		case "d":
+			err = parseFloat(fields[1:], &cur.d)
+		case "tr":
+			var tr float64
+			err = parseFloat(fields[1:], &tr)
+			cur.d = 1 - tr
+		case "illum":
+			var illum float64
+			err = parseFloat(fields[1:], &illum)
+			cur.illum = int(illum)
+		case "map_kd":
+			cur.mapKd = mapFile()
+		case "map_ks":
+			cur.mapKs = mapFile()
+		case "map_bump", "bump":
+			cur.bump = mapFile()
+		default:
+			// ambient, emission and the rest have no equivalent
+		}
+		if err != nil {
+			o.warnf(loc, "%s: %v", fields[0], err)
+		}
+	}
+	flush()
+	return s.Err()
+}
+
+func parseFloat(args []string, v *float64) error {
+	f, err := parseFloats(args, 1)
+	if err == nil {
+		*v = f[0]
+	}
+	return err
+}
+
+/*
+toMaterial picks the closest material: transparent entries become glass, entries
+with a specular color plastic and the rest matte. Texture maps are passed as
+"texture" parameters naming the image file.
+*/
+func (m *mtlMaterial) toMaterial() *core.Material {
+	params := core.NewParamSet()
+	color := func(name string, rgb []float64, texture string) {
+		if texture != "" {
+			params.AddStrings(name, "texture", []string{texture})
+		} else if rgb != nil {
+			params.AddFloats(name, "rgb", rgb)
+		}
+	}
+	if m.bump != "" {
+		params.AddStrings("bumpmap", "texture", []string{m.bump})
+	}
+
+	// illumination models 4, 6, 7 and 9 are the transparent ones
+	if m.d < 1 || m.illum == 4 || m.illum == 6 || m.illum == 7 || m.illum == 9 {
+		params.AddFloats("eta", "float", []float64{m.ni})
+		return &core.Material{Desc: "glass", Params: params}
+	}
+	color("Kd", m.kd, m.mapKd)
+	hasSpecular := m.mapKs != "" || (m.ks != nil && (m.ks[0] > 0 || m.ks[1] > 0 || m.ks[2] > 0))
+	if !hasSpecular {
+		return &core.Material{Desc: "matte", Params: params}
+	}
+	color("Ks", m.ks, m.mapKs)
+	// Phong exponent to microfacet roughness
+	params.AddFloats("roughness", "float", []float64{math.Sqrt(2 / (m.ns + 2))})
+	params.AddBools("remaproughness", []bool{false})
+	return &core.Material{Desc: "plastic", Params: params}
+}
+
+// addOBJ adds the meshes of an OBJ file placed with objToWorld. Groups using an
+// MTL material get it, the others use the current material
+func (b *builder) addOBJ(obj *objFile, objToWorld, worldToObj *core.Transform) {
+	for _, w := range obj.warnings {
+		b.diags.Warningf(w.loc, "", "%s", w.msg)
+	}
+	for _, m := range obj.meshes {
+		material := b.gs.material
+		if mat, ok := obj.materials[m.material]; ok {
+			material = mat
+		}
+		b.addShapes(core.CreateTriangleMesh(objToWorld, worldToObj, b.gs.reverseOrientation,
+			m.indices, m.p, nil, m.n, m.uv), material)
+	}
+}
+
+// loadOBJMesh handles Shape "objmesh", the file name is relative to the scene file
+func (b *builder) loadOBJMesh(objToWorld, worldToObj *core.Transform, params *core.ParamSet) {
+	filename := params.FindOneString("filename", "")
+	b.warnUnused(params)
+	if filename == "" {
+		b.errorf("no \"filename\" given for objmesh")
+		return
+	}
+	obj, err := readOBJ(resolvePath(b.directive.loc.Filename, filename))
+	if err != nil {
+		b.errorf("couldn't read objmesh: %v", err)
+		return
+	}
+	b.addOBJ(obj, objToWorld, worldToObj)
+}
+
+/*
+ImportOBJ makes a scene out of a single OBJ file so assets can be rendered
+without writing a scene description: the default render options, a camera
+looking down -z at the whole model and an infinite light.
+*/
+func ImportOBJ(filename string) bool {
+	if api == nil {
+		api = newBuilder()
+	}
+	b := api
+	errs := b.diags.Errors()
+	b.directive = token{loc: system.Loc{Filename: filename}}
+	obj, err := readOBJ(filename)
+	if err != nil {
+		b.errorf("couldn't read OBJ file: %v", err)
+		return false
+	}
+
+	bounds := core.NewEmptyBounds3()
+	for _, m := range obj.meshes {
+		for _, p := range m.p {
+			bounds = core.UnionB3P(bounds, p)
+		}
+	}
+	b.frameCamera(bounds)
+
+	b.worldBegin()
+	b.lightSource("infinite", core.NewParamSet())
+	objToWorld, worldToObj := b.transforms.lookup(b.ctm[0])
+	b.addOBJ(obj, objToWorld, worldToObj)
+	b.worldEnd()
+	return b.diags.Errors() == errs
+}
+
+// frameCamera declares a perspective camera looking down -z that sees all of
+// bounds, for scenes made from files that have no camera of their own
+func (b *builder) frameCamera(bounds core.Bounds3) {
+	center, radius := bounds.BoundingSphere()
+	const fov = 45.0
+	dist := math.Max(radius, 1e-3) / math.Sin(core.Radians(fov/2))
+	b.identity()
+	b.lookAt(center.X, center.Y, center.Z+dist, center.X, center.Y, center.Z, 0, 1, 0)
+	cameraParams := core.NewParamSet()
+	cameraParams.AddFloats("fov", "float", []float64{fov})
+	b.camera("perspective", cameraParams)
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"Anvil/core"
+	"reflect"
+	"testing"
+)
+
+func TestObjIndex(t *testing.T) {
+	tests := []struct {
+		s     string
+		n, i  int
+		valid bool
+	}{
+		{"1", 3, 0, true},
+		{"3", 3, 2, true},
+		{"-1", 3, 2, true},
+		{"-3", 3, 0, true},
+		{"0", 3, 0, false},
+		{"4", 3, 0, false},
+		{"-4", 3, 0, false},
+		{"1", 0, 0, false},
+		{"x", 3, 0, false},
+	}
+	for _, test := range tests {
+		i, err := objIndex(test.s, test.n)
+		if (err == nil) != test.valid || err == nil && i != test.i {
+			t.Errorf("objIndex(%q, %d) = %d, %v, expected %d valid %v", test.s, test.n, i, err, test.i, test.valid)
+		}
+	}
+}
+
+func TestReadOBJ(t *testing.T) {
+	obj, err := readOBJ("testdata/obj/groups.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := []core.Point3{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 0}, {X: 0, Y: 1, Z: 0},
+		{X: 2, Y: 0.5, Z: 0}}
+	up, down := core.Normal3{Z: 1}, core.Normal3{Z: -1}
+	tests := []struct {
+		group, material string
+		p               []core.Point3
+		n               []core.Normal3
+		uv              []core.Point2
+		indices         []int
+	}{
+		// the quad is a fan of two triangles, the faces after it reuse its
+		// vertices unless the v/vt/vn combination is new. The last face has no uvs
+		// so the mesh has none
+		{"quad", "shiny", []core.Point3{v[0], v[1], v[2], v[3], v[0], v[1], v[4], v[2]},
+			[]core.Normal3{up, up, up, up, down, up, up, up}, nil,
+			[]int{0, 1, 2, 0, 2, 3, 0, 2, 3, 4, 1, 2, 5, 6, 7}},
+		{"poly", "glass", []core.Point3{v[0], v[1], v[4], v[2], v[3]}, nil, nil,
+			[]int{0, 1, 2, 0, 2, 3, 0, 3, 4}},
+		{"quad", "matte", []core.Point3{v[0], v[1], v[2]}, nil, nil, []int{0, 1, 2}},
+	}
+	if len(obj.meshes) != len(tests) {
+		t.Fatalf("%d meshes, expected %d", len(obj.meshes), len(tests))
+	}
+	for i, test := range tests {
+		m := obj.meshes[i]
+		if m.group != test.group || m.material != test.material {
+			t.Errorf("mesh %d is group %q material %q, expected %q %q", i, m.group, m.material, test.group,
+				test.material)
+		}
+		if !reflect.DeepEqual(m.p, test.p) || !reflect.DeepEqual(m.n, test.n) || !reflect.DeepEqual(m.uv, test.uv) {
+			t.Errorf("mesh %d: vertices %v normals %v uvs %v", i, m.p, m.n, m.uv)
+		}
+		if !reflect.DeepEqual(m.indices, test.indices) {
+			t.Errorf("mesh %d: indices %v, expected %v", i, m.indices, test.indices)
+		}
+	}
+	for name, desc := range map[string]string{"shiny": "plastic", "glass": "glass", "matte": "matte"} {
+		if m, ok := obj.materials[name]; !ok || m.Desc != desc {
+			t.Errorf("material %q is %v, expected %s", name, m, desc)
+		}
+	}
+	if len(obj.warnings) != 0 {
+		t.Errorf("unexpected warnings %v", obj.warnings)
+	}
+}
+
+func TestMTLToMaterial(t *testing.T) {
+	defaults := func(f func(m *mtlMaterial)) *mtlMaterial {
+		m := &mtlMaterial{ni: 1.5, d: 1, illum: 2}
+		f(m)
+		return m
+	}
+	tests := []struct {
+		name string
+		m    *mtlMaterial
+		desc string
+	}{
+		{"default", defaults(func(m *mtlMaterial) {}), "matte"},
+		{"diffuse", defaults(func(m *mtlMaterial) { m.kd = []float64{1, 0, 0} }), "matte"},
+		{"black specular", defaults(func(m *mtlMaterial) { m.ks = []float64{0, 0, 0} }), "matte"},
+		{"specular", defaults(func(m *mtlMaterial) { m.ks = []float64{0, 0.1, 0}; m.ns = 10 }), "plastic"},
+		{"specular map", defaults(func(m *mtlMaterial) { m.mapKs = "ks.png" }), "plastic"},
+		{"dissolve", defaults(func(m *mtlMaterial) { m.d = 0.9; m.ks = []float64{1, 1, 1} }), "glass"},
+		{"illum 4", defaults(func(m *mtlMaterial) { m.illum = 4 }), "glass"},
+		{"illum 6", defaults(func(m *mtlMaterial) { m.illum = 6 }), "glass"},
+		{"illum 7", defaults(func(m *mtlMaterial) { m.illum = 7 }), "glass"},
+		{"illum 9", defaults(func(m *mtlMaterial) { m.illum = 9; m.ni = 1.33 }), "glass"},
+		{"illum 5", defaults(func(m *mtlMaterial) { m.illum = 5 }), "matte"},
+	}
+	for _, test := range tests {
+		mat := test.m.toMaterial()
+		if mat.Desc != test.desc {
+			t.Errorf("%s: %s, expected %s", test.name, mat.Desc, test.desc)
+			continue
+		}
+		switch mat.Desc {
+		case "glass":
+			if eta := mat.Params.FindOneFloat("eta", 0); eta != test.m.ni {
+				t.Errorf("%s: eta %v, expected %v", test.name, eta, test.m.ni)
+			}
+		case "plastic":
+			if r := mat.Params.FindOneFloat("roughness", 0); r <= 0 || r > 1 {
+				t.Errorf("%s: roughness %v", test.name, r)
+			}
+			if test.m.mapKs != "" && mat.Params.FindOneTexture("Ks") != test.m.mapKs {
+				t.Errorf("%s: Ks texture %q, expected %q", test.name, mat.Params.FindOneTexture("Ks"), test.m.mapKs)
+			}
+		case "matte":
+			if test.m.kd != nil && !reflect.DeepEqual(mat.Params.FindOneSpectrum("Kd", nil), test.m.kd) {
+				t.Errorf("%s: Kd %v, expected %v", test.name, mat.Params.FindOneSpectrum("Kd", nil), test.m.kd)
+			}
+		}
+	}
+}
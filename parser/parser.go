@@ -1,15 +1,522 @@
 package parser
 
 import (
-    "fmt"
+	"Anvil/core"
+	"Anvil/system"
+	"strconv"
+	"strings"
 )
 
-func ParseFile(s string) bool {
-    fmt.Printf("Starting Parser...\n")
+// state shared by every file given on the command line, like pbrt the files are
+// treated as one long scene description
+var api *builder
 
-    if s == "-" {
-        fmt.Printf("Parsing from standard input")
-    }
-    
-    return true
+func Init(opt system.Options) {
+	api = newBuilder()
+	api.options = opt
+	api.diags.Quiet = opt.Quiet
+}
+
+func Cleanup() {
+	api = nil
+}
+
+// GetScene returns the render options of the last completed WorldBegin/WorldEnd
+// block, nil if none has been parsed
+func GetScene() *RenderOptions {
+	if api == nil {
+		return nil
+	}
+	return api.scene
+}
+
+// GetDiagnostics returns every problem reported while parsing so far
+func GetDiagnostics() *system.Diagnostics {
+	if api == nil {
+		return nil
+	}
+	return api.diags
+}
+
+// ParseFile parses a pbrt-v3 scene description, "-" reads from standard input.
+// Parsing carries on past errors so that every problem in the file is reported,
+// returns false if any of them were errors
+func ParseFile(filename string) bool {
+	if api == nil {
+		api = newBuilder()
+	}
+	errs := api.diags.Errors()
+	api.directive = token{}
+	if !api.parseFile(filename, system.Loc{Filename: filename}, "") {
+		return false
+	}
+	return api.diags.Errors() == errs
+}
+
+/*
+sceneParser reads directives from a tokenizer and forwards them to a builder.
+When a directive is malformed an error is reported at the offending token and
+the directive is dropped, if the token stream no longer makes sense (desync) the
+parser skips ahead to the next thing that looks like a directive and carries on.
+*/
+type sceneParser struct {
+	t     *tokenizer
+	b     *builder
+	diags *system.Diagnostics
+
+	peeked    token
+	hasPeeked bool
+
+	// invalid: the current directive will not be applied
+	// desync: stop reading the current directive and resynchronize
+	invalid, desync bool
+}
+
+func (p *sceneParser) errorf(tok token, format string, a ...interface{}) {
+	p.diags.Errorf(tok.loc, tok.text, format, a...)
+	p.invalid = true
+}
+
+// errors that leave the parser unsure where the next directive starts
+func (p *sceneParser) syntaxErrorf(tok token, format string, a ...interface{}) {
+	p.errorf(tok, format, a...)
+	p.desync = true
+}
+
+func (p *sceneParser) next() (token, bool) {
+	if p.hasPeeked {
+		p.hasPeeked = false
+		return p.peeked, true
+	}
+	return p.t.next()
+}
+
+func (p *sceneParser) peek() (token, bool) {
+	if !p.hasPeeked {
+		tok, ok := p.t.next()
+		if !ok {
+			return tok, false
+		}
+		p.peeked, p.hasPeeked = tok, true
+	}
+	return p.peeked, true
+}
+
+// directives are bare words starting with a capital letter
+func isDirective(tok token) bool {
+	return len(tok.text) > 0 && tok.text[0] >= 'A' && tok.text[0] <= 'Z'
+}
+
+func (p *sceneParser) skipToDirective() {
+	for {
+		tok, ok := p.peek()
+		if !ok || isDirective(tok) {
+			return
+		}
+		p.next()
+	}
+}
+
+// the expect functions leave a token that doesn't match in the stream so that
+// resynchronizing can pick it up if it is the next directive
+func (p *sceneParser) expectFloat() float64 {
+	if p.desync {
+		return 0
+	}
+	tok, ok := p.peek()
+	if !ok {
+		p.syntaxErrorf(tok, "premature end of file, expected a number")
+		return 0
+	}
+	f, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		p.syntaxErrorf(tok, "expected a number")
+		return 0
+	}
+	p.next()
+	return f
+}
+
+func (p *sceneParser) expectFloats(n int) []float64 {
+	ret := make([]float64, n)
+	for i := range ret {
+		ret[i] = p.expectFloat()
+	}
+	return ret
+}
+
+func (p *sceneParser) expectString() string {
+	if p.desync {
+		return ""
+	}
+	tok, ok := p.peek()
+	if !ok {
+		p.syntaxErrorf(tok, "premature end of file, expected a quoted string")
+		return ""
+	}
+	if !isQuoted(tok.text) {
+		p.syntaxErrorf(tok, "expected a quoted string")
+		return ""
+	}
+	p.next()
+	return dequote(tok.text)
+}
+
+// reads a bracketed list of n numbers such as the 16 values of a Transform
+func (p *sceneParser) expectFloatArray(n int) []float64 {
+	if p.desync {
+		return nil
+	}
+	tok, ok := p.peek()
+	if !ok || tok.text != "[" {
+		p.syntaxErrorf(tok, "expected '[' to start a list of %d numbers", n)
+		return nil
+	}
+	p.next()
+	ret := p.expectFloats(n)
+	if p.desync {
+		return nil
+	}
+	if tok, ok = p.peek(); !ok || tok.text != "]" {
+		p.syntaxErrorf(tok, "expected ']' after a list of %d numbers", n)
+		return nil
+	}
+	p.next()
+	return ret
+}
+
+// parseValues reads the value(s) of a parameter, either a single value or a list
+// in square brackets
+func (p *sceneParser) parseValues() []token {
+	tok, ok := p.peek()
+	if !ok {
+		p.syntaxErrorf(tok, "premature end of file, expected parameter value")
+		return nil
+	}
+	if tok.text == "]" || isDirective(tok) {
+		p.syntaxErrorf(tok, "expected parameter value")
+		return nil
+	}
+	p.next()
+	if tok.text != "[" {
+		return []token{tok}
+	}
+	open := tok
+	var ret []token
+	for {
+		tok, ok = p.peek()
+		if !ok {
+			p.syntaxErrorf(open, "unterminated parameter list")
+			return nil
+		}
+		if isDirective(tok) {
+			p.syntaxErrorf(tok, "expected ']' to close parameter list")
+			return nil
+		}
+		p.next()
+		if tok.text == "]" {
+			return ret
+		}
+		ret = append(ret, tok)
+	}
+}
+
+func isBoolWord(s string) bool {
+	return s == "true" || s == "false"
+}
+
+// parseParams reads "type name" value pairs until the next directive, a bad value
+// invalidates the directive but the remaining parameters are still checked
+func (p *sceneParser) parseParams() core.ParamSet {
+	ps := core.NewParamSet()
+	for !p.desync {
+		decl, ok := p.peek()
+		if !ok || !isQuoted(decl.text) {
+			break
+		}
+		p.next()
+		fields := strings.Fields(dequote(decl.text))
+		if len(fields) != 2 {
+			p.syntaxErrorf(decl, "malformed parameter declaration, expected \"type name\"")
+			break
+		}
+		typ, name := fields[0], fields[1]
+		vals := p.parseValues()
+		if p.desync {
+			break
+		}
+		p.addParam(&ps, decl, typ, name, vals)
+	}
+	return ps
+}
+
+// number of floats that make up one value of each numeric parameter type
+var typeArity = map[string]int{
+	"integer": 1, "float": 1,
+	"point2": 2, "vector2": 2,
+	"point3": 3, "vector3": 3, "normal3": 3,
+	"point": 3, "vector": 3, "normal": 3,
+	"rgb": 3, "color": 3, "xyz": 3,
+	"spectrum": 2, "blackbody": 2,
+}
+
+func (p *sceneParser) addParam(ps *core.ParamSet, decl token, typ, name string, vals []token) {
+	switch typ {
+	case "string", "texture":
+		s := make([]string, len(vals))
+		for i, v := range vals {
+			if !isQuoted(v.text) {
+				p.errorf(v, "parameter \"%s %s\" expects quoted strings", typ, name)
+				return
+			}
+			s[i] = dequote(v.text)
+		}
+		ps.AddStrings(name, typ, s)
+	case "bool":
+		// bools are usually quoted ("true") but we also accept them bare
+		bs := make([]bool, len(vals))
+		for i, v := range vals {
+			s := v.text
+			if isQuoted(s) {
+				s = dequote(s)
+			}
+			if !isBoolWord(s) {
+				p.errorf(v, "parameter \"bool %s\" expects true or false", name)
+				return
+			}
+			bs[i] = s == "true"
+		}
+		ps.AddBools(name, bs)
+	default:
+		arity, known := typeArity[typ]
+		if !known {
+			p.errorf(decl, "unknown parameter type %q", typ)
+			return
+		}
+		// sampled spectra may also be given as a filename
+		if typ == "spectrum" && len(vals) == 1 && isQuoted(vals[0].text) {
+			ps.AddStrings(name, typ, []string{dequote(vals[0].text)})
+			return
+		}
+		fs := make([]float64, len(vals))
+		for i, v := range vals {
+			f, err := strconv.ParseFloat(v.text, 64)
+			if err != nil {
+				p.errorf(v, "parameter \"%s %s\" expects numbers", typ, name)
+				return
+			}
+			if typ == "integer" && f != float64(int(f)) {
+				p.errorf(v, "parameter \"integer %s\" has a non-integer value", name)
+				return
+			}
+			fs[i] = f
+		}
+		if len(fs)%arity != 0 {
+			p.errorf(decl, "parameter of type %s needs a multiple of %d values, got %d", typ, arity, len(fs))
+			return
+		}
+		ps.AddFloats(name, typ, fs)
+	}
+}
+
+func (p *sceneParser) parse() {
+	for {
+		tok, ok := p.next()
+		if !ok {
+			return
+		}
+		p.invalid, p.desync = false, false
+		p.b.directive = tok
+		p.directive(tok)
+		if p.desync {
+			p.skipToDirective()
+		}
+	}
+}
+
+// directive reads the arguments of a single directive and applies it if they were valid
+func (p *sceneParser) directive(tok token) {
+	switch tok.text {
+	case "Accelerator":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.accelerator(name, params)
+		}
+	case "ActiveTransform":
+		// the argument is a bare word
+		which, ok := p.next()
+		if !ok {
+			p.syntaxErrorf(which, "premature end of file, expected StartTime, EndTime or All")
+		} else {
+			p.b.activeTransform(which.text)
+		}
+	case "AreaLightSource":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.areaLightSource(name, params)
+		}
+	case "AttributeBegin":
+		p.b.attributeBegin()
+	case "AttributeEnd":
+		p.b.attributeEnd()
+	case "Camera":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.camera(name, params)
+		}
+	case "ConcatTransform":
+		tr := p.expectFloatArray(16)
+		if !p.invalid {
+			p.b.concatTransform(tr)
+		}
+	case "CoordinateSystem":
+		name := p.expectString()
+		if !p.invalid {
+			p.b.coordinateSystem(name)
+		}
+	case "CoordSysTransform":
+		name := p.expectString()
+		if !p.invalid {
+			p.b.coordSysTransform(name)
+		}
+	case "Film":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.film(name, params)
+		}
+	case "Identity":
+		p.b.identity()
+	case "Integrator":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.integrator(name, params)
+		}
+	case "Import":
+		filename := p.expectString()
+		if !p.invalid {
+			p.b.importFile(filename)
+		}
+	case "Include":
+		filename := p.expectString()
+		if !p.invalid {
+			p.b.include(filename)
+		}
+	case "LightSource":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.lightSource(name, params)
+		}
+	case "LookAt":
+		v := p.expectFloats(9)
+		if !p.invalid {
+			p.b.lookAt(v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7], v[8])
+		}
+	case "MakeNamedMedium":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.makeNamedMedium(name, params)
+		}
+	case "Material":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.material(name, params)
+		}
+	case "MediumInterface":
+		// the outside medium is optional and defaults to the inside one
+		inside := p.expectString()
+		outside := inside
+		if tok, ok := p.peek(); ok && isQuoted(tok.text) {
+			outside = p.expectString()
+		}
+		if !p.invalid {
+			p.b.mediumInterface(inside, outside)
+		}
+	case "ObjectBegin":
+		name := p.expectString()
+		if !p.invalid {
+			p.b.objectBegin(name)
+		}
+	case "ObjectEnd":
+		p.b.objectEnd()
+	case "ObjectInstance":
+		name := p.expectString()
+		if !p.invalid {
+			p.b.objectInstance(name)
+		}
+	case "PixelFilter":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.pixelFilter(name, params)
+		}
+	case "ReverseOrientation":
+		p.b.reverseOrientation()
+	case "Rotate":
+		v := p.expectFloats(4)
+		if !p.invalid {
+			p.b.rotate(v[0], v[1], v[2], v[3])
+		}
+	case "Sampler":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.sampler(name, params)
+		}
+	case "Scale":
+		v := p.expectFloats(3)
+		if !p.invalid {
+			p.b.scale(v[0], v[1], v[2])
+		}
+	case "Shape":
+		name := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.shape(name, params)
+		}
+	case "Texture":
+		name := p.expectString()
+		typ := p.expectString()
+		class := p.expectString()
+		params := p.parseParams()
+		if !p.invalid {
+			p.b.texture(name, typ, class, params)
+		}
+	case "Transform":
+		tr := p.expectFloatArray(16)
+		if !p.invalid {
+			p.b.transform(tr)
+		}
+	case "TransformBegin":
+		p.b.transformBegin()
+	case "TransformEnd":
+		p.b.transformEnd()
+	case "TransformTimes":
+		v := p.expectFloats(2)
+		if !p.invalid {
+			p.b.transformTimes(v[0], v[1])
+		}
+	case "Translate":
+		v := p.expectFloats(3)
+		if !p.invalid {
+			p.b.translate(v[0], v[1], v[2])
+		}
+	case "WorldBegin":
+		p.b.worldBegin()
+	case "WorldEnd":
+		p.b.worldEnd()
+	default:
+		if isDirective(tok) {
+			p.syntaxErrorf(tok, "unknown directive")
+		} else {
+			p.syntaxErrorf(tok, "unexpected token, expected a directive")
+		}
+	}
 }
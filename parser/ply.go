@@ -0,0 +1,402 @@
+package parser
+
+import (
+	"Anvil/core"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// scalar types a PLY property can have
+type plyType int
+
+const (
+	plyInt8 plyType = iota
+	plyUint8
+	plyInt16
+	plyUint16
+	plyInt32
+	plyUint32
+	plyFloat32
+	plyFloat64
+)
+
+// both the old and the sized type names are in use
+var plyTypes = map[string]plyType{
+	"char": plyInt8, "int8": plyInt8,
+	"uchar": plyUint8, "uint8": plyUint8,
+	"short": plyInt16, "int16": plyInt16,
+	"ushort": plyUint16, "uint16": plyUint16,
+	"int": plyInt32, "int32": plyInt32,
+	"uint": plyUint32, "uint32": plyUint32,
+	"float": plyFloat32, "float32": plyFloat32,
+	"double": plyFloat64, "float64": plyFloat64,
+}
+
+type plyProperty struct {
+	name string
+	typ  plyType
+	// lists are prefixed by their length which has its own type
+	isList    bool
+	countType plyType
+}
+
+type plyElement struct {
+	name  string
+	count int
+	props []plyProperty
+}
+
+// plyValueReader reads the next value of the body, ascii and binary files
+// only differ in how values are stored
+type plyValueReader interface {
+	read(t plyType) (float64, error)
+}
+
+type plyASCIIReader struct {
+	s *bufio.Scanner
+}
+
+func (r plyASCIIReader) read(t plyType) (float64, error) {
+	if !r.s.Scan() {
+		if err := r.s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	return strconv.ParseFloat(r.s.Text(), 64)
+}
+
+type plyBinaryReader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	buf   [8]byte
+}
+
+func (r *plyBinaryReader) read(t plyType) (float64, error) {
+	size := [...]int{1, 1, 2, 2, 4, 4, 4, 8}[t]
+	b := r.buf[:size]
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	switch t {
+	case plyInt8:
+		return float64(int8(b[0])), nil
+	case plyUint8:
+		return float64(b[0]), nil
+	case plyInt16:
+		return float64(int16(r.order.Uint16(b))), nil
+	case plyUint16:
+		return float64(r.order.Uint16(b)), nil
+	case plyInt32:
+		return float64(int32(r.order.Uint32(b))), nil
+	case plyUint32:
+		return float64(r.order.Uint32(b)), nil
+	case plyFloat32:
+		return float64(math.Float32frombits(r.order.Uint32(b))), nil
+	default:
+		return math.Float64frombits(r.order.Uint64(b)), nil
+	}
+}
+
+// plyMesh is the geometry read from a PLY file, n and uv are nil if the vertices
+// don't have them
+type plyMesh struct {
+	p       []core.Point3
+	n       []core.Normal3
+	uv      []core.Point2
+	indices []int
+	// faces that weren't triangles or quads
+	skippedFaces int
+}
+
+// readPLY loads the vertices and faces of a PLY file, other elements are skipped.
+// Quads are split in two triangles
+func readPLY(filename string) (*plyMesh, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	elements, format, err := readPLYHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	var values plyValueReader
+	switch format {
+	case "ascii":
+		s := bufio.NewScanner(r)
+		s.Split(bufio.ScanWords)
+		values = plyASCIIReader{s}
+	case "binary_little_endian":
+		values = &plyBinaryReader{r: r, order: binary.LittleEndian}
+	case "binary_big_endian":
+		values = &plyBinaryReader{r: r, order: binary.BigEndian}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PLY format %q", filename, format)
+	}
+
+	mesh := &plyMesh{}
+	for _, e := range elements {
+		switch e.name {
+		case "vertex":
+			err = mesh.readVertices(values, e)
+		case "face":
+			err = mesh.readFaces(values, e)
+		default:
+			err = skipPLYElement(values, e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading %s: %v", filename, e.name, err)
+		}
+	}
+	for _, i := range mesh.indices {
+		if i < 0 || i >= len(mesh.p) {
+			return nil, fmt.Errorf("%s: vertex index %d out of range, the file has %d vertices",
+				filename, i, len(mesh.p))
+		}
+	}
+	return mesh, nil
+}
+
+func readPLYHeader(r *bufio.Reader) ([]plyElement, string, error) {
+	var elements []plyElement
+	format := ""
+	for lineNum := 1; ; lineNum++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, "", fmt.Errorf("header ends before end_header")
+		}
+		fields := strings.Fields(line)
+		if lineNum == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return nil, "", fmt.Errorf("not a PLY file")
+			}
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return nil, "", fmt.Errorf("line %d: malformed format", lineNum)
+			}
+			format = fields[1]
+		case "comment", "obj_info":
+		case "element":
+			if len(fields) != 3 {
+				return nil, "", fmt.Errorf("line %d: malformed element", lineNum)
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, "", fmt.Errorf("line %d: bad element count %q", lineNum, fields[2])
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, "", fmt.Errorf("line %d: property before any element", lineNum)
+			}
+			prop, err := parsePLYProperty(fields[1:])
+			if err != nil {
+				return nil, "", fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			e := &elements[len(elements)-1]
+			e.props = append(e.props, prop)
+		case "end_header":
+			if format == "" {
+				return nil, "", fmt.Errorf("no format in header")
+			}
+			return elements, format, nil
+		default:
+			return nil, "", fmt.Errorf("line %d: unknown header keyword %q", lineNum, fields[0])
+		}
+	}
+}
+
+func parsePLYProperty(fields []string) (plyProperty, error) {
+	if len(fields) == 4 && fields[0] == "list" {
+		countType, ok1 := plyTypes[fields[1]]
+		typ, ok2 := plyTypes[fields[2]]
+		if !ok1 || !ok2 {
+			return plyProperty{}, fmt.Errorf("unknown list types %q %q", fields[1], fields[2])
+		}
+		return plyProperty{name: fields[3], typ: typ, isList: true, countType: countType}, nil
+	}
+	if len(fields) != 2 {
+		return plyProperty{}, fmt.Errorf("malformed property")
+	}
+	typ, ok := plyTypes[fields[0]]
+	if !ok {
+		return plyProperty{}, fmt.Errorf("unknown property type %q", fields[0])
+	}
+	return plyProperty{name: fields[1], typ: typ}, nil
+}
+
+// longest list property accepted, face lists are a handful of indices so anything
+// near this is a corrupt file
+const maxPLYListLength = 1 << 16
+
+// readList reads the length of a list property then its items
+func readList(values plyValueReader, prop plyProperty) ([]float64, error) {
+	n, err := values.read(prop.countType)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > maxPLYListLength || n != math.Trunc(n) {
+		return nil, fmt.Errorf("bad list length %v", n)
+	}
+	var list []float64
+	for i := 0; i < int(n); i++ {
+		v, err := values.read(prop.typ)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func skipPLYElement(values plyValueReader, e plyElement) error {
+	for i := 0; i < e.count; i++ {
+		for _, prop := range e.props {
+			var err error
+			if prop.isList {
+				_, err = readList(values, prop)
+			} else {
+				_, err = values.read(prop.typ)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *plyMesh) readVertices(values plyValueReader, e plyElement) error {
+	// where each property goes, -1 for the ones that aren't used
+	const (
+		px = iota
+		py
+		pz
+		nx
+		ny
+		nz
+		u
+		v
+	)
+	slots := make([]int, len(e.props))
+	var found [8]bool
+	for i, prop := range e.props {
+		slot := -1
+		switch prop.name {
+		case "x":
+			slot = px
+		case "y":
+			slot = py
+		case "z":
+			slot = pz
+		case "nx":
+			slot = nx
+		case "ny":
+			slot = ny
+		case "nz":
+			slot = nz
+		case "u", "s", "texture_u", "texture_s":
+			slot = u
+		case "v", "t", "texture_v", "texture_t":
+			slot = v
+		}
+		if prop.isList {
+			slot = -1
+		}
+		slots[i] = slot
+		if slot >= 0 {
+			found[slot] = true
+		}
+	}
+	if !found[px] || !found[py] || !found[pz] {
+		return fmt.Errorf("vertices have no x, y and z")
+	}
+	hasNormals := found[nx] && found[ny] && found[nz]
+	hasUVs := found[u] && found[v]
+
+	// the slices grow as vertices are read so a bad count in the header runs
+	// into the end of the file instead of allocating it up front
+	for i := 0; i < e.count; i++ {
+		var vals [8]float64
+		for j, prop := range e.props {
+			if prop.isList {
+				if _, err := readList(values, prop); err != nil {
+					return err
+				}
+				continue
+			}
+			val, err := values.read(prop.typ)
+			if err != nil {
+				return err
+			}
+			if slots[j] >= 0 {
+				vals[slots[j]] = val
+			}
+		}
+		m.p = append(m.p, core.Point3{X: vals[px], Y: vals[py], Z: vals[pz]})
+		if hasNormals {
+			m.n = append(m.n, core.Normal3{X: vals[nx], Y: vals[ny], Z: vals[nz]})
+		}
+		if hasUVs {
+			m.uv = append(m.uv, core.Point2{X: vals[u], Y: vals[v]})
+		}
+	}
+	return nil
+}
+
+func (m *plyMesh) readFaces(values plyValueReader, e plyElement) error {
+	indicesProp := -1
+	for i, prop := range e.props {
+		if prop.isList && (prop.name == "vertex_indices" || prop.name == "vertex_index") {
+			indicesProp = i
+		}
+	}
+	if indicesProp < 0 {
+		return fmt.Errorf("faces have no vertex_indices")
+	}
+	for i := 0; i < e.count; i++ {
+		for j, prop := range e.props {
+			if !prop.isList {
+				if _, err := values.read(prop.typ); err != nil {
+					return err
+				}
+				continue
+			}
+			list, err := readList(values, prop)
+			if err != nil {
+				return err
+			}
+			if j != indicesProp {
+				continue
+			}
+			switch len(list) {
+			case 3:
+				m.indices = append(m.indices, int(list[0]), int(list[1]), int(list[2]))
+			case 4:
+				m.indices = append(m.indices, int(list[0]), int(list[1]), int(list[2]),
+					int(list[0]), int(list[2]), int(list[3]))
+			default:
+				m.skippedFaces++
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"Anvil/core"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPLY(t *testing.T) {
+	p := []core.Point3{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 1, Y: 1, Z: 0}, {X: 0, Y: 1, Z: 0},
+		{X: 0.5, Y: 2, Z: 0.25}}
+	uv := []core.Point2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}, {X: 0.5, Y: 2}}
+	// the quad is split in two, the pentagon is skipped
+	indices := []int{0, 1, 2, 0, 2, 3, 3, 2, 4}
+	tests := []struct {
+		file string
+		n    []core.Normal3
+	}{
+		{"ascii.ply", []core.Normal3{{Z: 1}, {Z: 1}, {Z: 1}, {Z: 1}, {Y: 1}}},
+		{"binary_little_endian.ply", nil},
+		{"binary_big_endian.ply", nil},
+	}
+	for _, test := range tests {
+		mesh, err := readPLY("testdata/ply/" + test.file)
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(mesh.p, p) || !reflect.DeepEqual(mesh.uv, uv) || !reflect.DeepEqual(mesh.n, test.n) {
+			t.Errorf("%s: vertices %v normals %v uvs %v", test.file, mesh.p, mesh.n, mesh.uv)
+		}
+		if !reflect.DeepEqual(mesh.indices, indices) || mesh.skippedFaces != 1 {
+			t.Errorf("%s: indices %v and %d skipped faces, expected %v and 1", test.file, mesh.indices,
+				mesh.skippedFaces, indices)
+		}
+	}
+}
+
+func TestReadPLYErrors(t *testing.T) {
+	tests := []struct {
+		file, err string
+	}{
+		{"bad_index.ply", "vertex index 3 out of range"},
+		{"truncated.ply", "unexpected EOF"},
+		{"huge_count.ply", "unexpected EOF"},
+		{"huge_list.ply", "bad list length"},
+		{"missing.ply", "no such file"},
+	}
+	for _, test := range tests {
+		_, err := readPLY("testdata/ply/" + test.file)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, expected %q", test.file, err, test.err)
+		}
+	}
+}
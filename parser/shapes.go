@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"Anvil/core"
+	"fmt"
+)
+
+func makeSphere(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) core.ShapeInter {
+	radius := params.FindOneFloat("radius", 1)
+	zMin := params.FindOneFloat("zmin", -radius)
+	zMax := params.FindOneFloat("zmax", radius)
+	phiMax := params.FindOneFloat("phimax", 360)
+	return core.NewSphere(objToWorld, worldToObj, reverseOrientation, radius, zMin, zMax,
+		core.Radians(core.Clamp(phiMax, 0, 360)))
+}
+
+func makeDisk(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) core.ShapeInter {
+	height := params.FindOneFloat("height", 0)
+	radius := params.FindOneFloat("radius", 1)
+	innerRadius := params.FindOneFloat("innerradius", 0)
+	phiMax := params.FindOneFloat("phimax", 360)
+	return core.NewDisk(objToWorld, worldToObj, reverseOrientation, height, radius, innerRadius,
+		core.Radians(core.Clamp(phiMax, 0, 360)))
+}
+
+func makeCylinder(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) core.ShapeInter {
+	radius := params.FindOneFloat("radius", 1)
+	zMin := params.FindOneFloat("zmin", -1)
+	zMax := params.FindOneFloat("zmax", 1)
+	phiMax := params.FindOneFloat("phimax", 360)
+	return core.NewCylinder(objToWorld, worldToObj, reverseOrientation, radius, zMin, zMax,
+		core.Radians(core.Clamp(phiMax, 0, 360)))
+}
+
+func makeCone(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) core.ShapeInter {
+	radius := params.FindOneFloat("radius", 1)
+	height := params.FindOneFloat("height", 1)
+	phiMax := params.FindOneFloat("phimax", 360)
+	return core.NewCone(objToWorld, worldToObj, reverseOrientation, height, radius,
+		core.Radians(core.Clamp(phiMax, 0, 360)))
+}
+
+func makeParaboloid(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) core.ShapeInter {
+	radius := params.FindOneFloat("radius", 1)
+	zMin := params.FindOneFloat("zmin", 0)
+	zMax := params.FindOneFloat("zmax", 1)
+	phiMax := params.FindOneFloat("phimax", 360)
+	return core.NewParaboloid(objToWorld, worldToObj, reverseOrientation, radius, zMin, zMax,
+		core.Radians(core.Clamp(phiMax, 0, 360)))
+}
+
+// makeHyperboloid rejects segments at constant z, they sweep an annulus that a
+// hyperboloid can't represent
+func makeHyperboloid(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) ([]core.ShapeInter, error) {
+	p1 := params.FindOnePoint3("p1", core.Point3{X: 0, Y: 0, Z: 0})
+	p2 := params.FindOnePoint3("p2", core.Point3{X: 1, Y: 1, Z: 1})
+	phiMax := params.FindOneFloat("phimax", 360)
+	if p1.Z == p2.Z {
+		return nil, fmt.Errorf("hyperboloid \"p1\" and \"p2\" have the same z %v, use a disk", p1.Z)
+	}
+	return []core.ShapeInter{core.NewHyperboloid(objToWorld, worldToObj, reverseOrientation, p1, p2,
+		core.Radians(core.Clamp(phiMax, 0, 360)))}, nil
+}
+
+// makeTriangleMesh checks the vertex data of a "trianglemesh", optional data that
+// doesn't match the number of vertices is dropped with a warning
+func (b *builder) makeTriangleMesh(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) ([]core.ShapeInter, error) {
+	indices := params.FindInt("indices")
+	p := params.FindPoint3("P")
+	if len(p) == 0 {
+		return nil, fmt.Errorf("vertex positions \"P\" not provided with triangle mesh shape")
+	}
+	if indices == nil {
+		// a single triangle doesn't need indices
+		if len(p) != 3 {
+			return nil, fmt.Errorf("vertex indices \"indices\" not provided with triangle mesh shape")
+		}
+		indices = []int{0, 1, 2}
+	}
+	if len(indices)%3 != 0 {
+		return nil, fmt.Errorf("number of vertex indices %d not a multiple of 3", len(indices))
+	}
+	for _, i := range indices {
+		if i < 0 || i >= len(p) {
+			return nil, fmt.Errorf("trianglemesh has out of bounds vertex index %d (%d \"P\" values were given)",
+				i, len(p))
+		}
+	}
+
+	uv := params.FindPoint2("uv")
+	if uv == nil {
+		// older scenes give uvs as a flat float array
+		if fuv := params.FindFloat("uv"); len(fuv) > 0 {
+			uv = make([]core.Point2, len(fuv)/2)
+			for i := range uv {
+				uv[i] = core.Point2{X: fuv[2*i], Y: fuv[2*i+1]}
+			}
+		}
+	}
+	if uv != nil && len(uv) != len(p) {
+		b.warningf("number of \"uv\"s for triangle mesh must match \"P\"s, discarding uvs")
+		uv = nil
+	}
+	s := params.FindVec3("S")
+	if s != nil && len(s) != len(p) {
+		b.warningf("number of \"S\"s for triangle mesh must match \"P\"s, discarding \"S\"s")
+		s = nil
+	}
+	n := params.FindNormal3("N")
+	if n != nil && len(n) != len(p) {
+		b.warningf("number of \"N\"s for triangle mesh must match \"P\"s, discarding \"N\"s")
+		n = nil
+	}
+	return core.CreateTriangleMesh(objToWorld, worldToObj, reverseOrientation, indices, p, s, n, uv), nil
+}
+
+// makePLYMesh loads a "plymesh", the file name is relative to the scene file
+func (b *builder) makePLYMesh(objToWorld, worldToObj *core.Transform, reverseOrientation bool,
+	params *core.ParamSet) ([]core.ShapeInter, error) {
+	filename := params.FindOneString("filename", "")
+	if filename == "" {
+		return nil, fmt.Errorf("no \"filename\" given for plymesh")
+	}
+	mesh, err := readPLY(resolvePath(b.directive.loc.Filename, filename))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read plymesh: %v", err)
+	}
+	if mesh.skippedFaces > 0 {
+		b.warningf("%s: ignored %d faces that weren't triangles or quads", filename, mesh.skippedFaces)
+	}
+	return core.CreateTriangleMesh(objToWorld, worldToObj, reverseOrientation, mesh.indices, mesh.p, nil,
+		mesh.n, mesh.uv), nil
+}
+
+// makeShapes creates the shapes for a Shape directive, some shape types (meshes)
+// can produce more than one. Unknown shape types return no shapes and no error
+func (b *builder) makeShapes(name string, objToWorld, worldToObj *core.Transform,
+	reverseOrientation bool, params *core.ParamSet) ([]core.ShapeInter, error) {
+	switch name {
+	case "sphere":
+		return []core.ShapeInter{makeSphere(objToWorld, worldToObj, reverseOrientation, params)}, nil
+	case "disk":
+		return []core.ShapeInter{makeDisk(objToWorld, worldToObj, reverseOrientation, params)}, nil
+	case "cylinder":
+		return []core.ShapeInter{makeCylinder(objToWorld, worldToObj, reverseOrientation, params)}, nil
+	case "cone":
+		return []core.ShapeInter{makeCone(objToWorld, worldToObj, reverseOrientation, params)}, nil
+	case "paraboloid":
+		return []core.ShapeInter{makeParaboloid(objToWorld, worldToObj, reverseOrientation, params)}, nil
+	case "hyperboloid":
+		return makeHyperboloid(objToWorld, worldToObj, reverseOrientation, params)
+	case "trianglemesh":
+		return b.makeTriangleMesh(objToWorld, worldToObj, reverseOrientation, params)
+	case "plymesh":
+		return b.makePLYMesh(objToWorld, worldToObj, reverseOrientation, params)
+	}
+	return nil, nil
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"Anvil/system"
+	"io"
+	"os"
+)
+
+// token is a piece of the scene description along with where it starts
+type token struct {
+	text string
+	loc  system.Loc
+}
+
+/*
+Splits a pbrt-v3 scene description into tokens. A token is one of
+  - a quoted string, the quotes are kept so callers can tell "1" from 1
+  - an opening or closing square bracket
+  - anything else delimited by whitespace (directive names, numbers, true/false)
+
+Comments run from '#' to the end of the line and are dropped.
+*/
+type tokenizer struct {
+	src       []byte
+	pos       int
+	line, col int
+	filename  string
+}
+
+func newTokenizer(filename string) (*tokenizer, error) {
+	var src []byte
+	var err error
+	if filename == "-" {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tokenizer{src: src, line: 1, col: 1, filename: filename}, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r'
+}
+
+func (t *tokenizer) loc() system.Loc {
+	return system.Loc{Filename: t.filename, Line: t.line, Column: t.col}
+}
+
+// advance moves past the current byte keeping line and column up to date
+func (t *tokenizer) advance() {
+	if t.src[t.pos] == '\n' {
+		t.line++
+		t.col = 1
+	} else {
+		t.col++
+	}
+	t.pos++
+}
+
+// next returns the next token, or false once the input is exhausted
+func (t *tokenizer) next() (token, bool) {
+	for t.pos < len(t.src) {
+		c := t.src[t.pos]
+		loc := t.loc()
+		switch {
+		case isSpace(c):
+			t.advance()
+		case c == '#':
+			for t.pos < len(t.src) && t.src[t.pos] != '\n' && t.src[t.pos] != '\r' {
+				t.advance()
+			}
+		case c == '[' || c == ']':
+			t.advance()
+			return token{string(c), loc}, true
+		case c == '"':
+			start := t.pos
+			t.advance()
+			for t.pos < len(t.src) && t.src[t.pos] != '"' {
+				if t.src[t.pos] == '\\' && t.pos+1 < len(t.src) {
+					t.advance()
+				}
+				t.advance()
+			}
+			// include the closing quote, an unterminated string runs to EOF
+			if t.pos < len(t.src) {
+				t.advance()
+			}
+			return token{string(t.src[start:t.pos]), loc}, true
+		default:
+			start := t.pos
+			for t.pos < len(t.src) {
+				c = t.src[t.pos]
+				if isSpace(c) || c == '"' || c == '[' || c == ']' || c == '#' {
+					break
+				}
+				t.advance()
+			}
+			return token{string(t.src[start:t.pos]), loc}, true
+		}
+	}
+	return token{"", t.loc()}, false
+}
+
+func isQuoted(tok string) bool {
+	return len(tok) >= 2 && tok[0] == '"' && tok[len(tok)-1] == '"'
+}
+
+// strips quotes and resolves the escape sequences pbrt allows inside strings
+func dequote(tok string) string {
+	tok = tok[1 : len(tok)-1]
+	ret := make([]byte, 0, len(tok))
+	for i := 0; i < len(tok); i++ {
+		if tok[i] != '\\' || i+1 == len(tok) {
+			ret = append(ret, tok[i])
+			continue
+		}
+		i++
+		switch tok[i] {
+		case 'b':
+			ret = append(ret, '\b')
+		case 'f':
+			ret = append(ret, '\f')
+		case 'n':
+			ret = append(ret, '\n')
+		case 'r':
+			ret = append(ret, '\r')
+		case 't':
+			ret = append(ret, '\t')
+		default:
+			ret = append(ret, tok[i])
+		}
+	}
+	return string(ret)
+}
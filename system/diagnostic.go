@@ -0,0 +1,118 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+	// a fatal problem stops processing of the current file
+	SeverityFatal
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "fatal"
+	}
+}
+
+// Loc is a position in a scene file, lines and columns start at 1
+type Loc struct {
+	Filename     string
+	Line, Column int
+}
+
+func (l Loc) String() string {
+	if l.Line == 0 {
+		return l.Filename
+	}
+	return fmt.Sprintf("%s:%d:%d", l.Filename, l.Line, l.Column)
+}
+
+// Diagnostic is a single problem found in a scene file, Token is the offending
+// token as it appears in the file, empty if the problem is not tied to one
+type Diagnostic struct {
+	Loc      Loc
+	Severity Severity
+	Token    string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%v: %v: %s", d.Loc, d.Severity, d.Message)
+	if d.Token != "" {
+		s += fmt.Sprintf(" (at %s)", d.Token)
+	}
+	return s
+}
+
+// Diagnostics collects problems so that a whole file can be checked in one pass,
+// each one is printed to stderr as it is reported. It is safe for concurrent use
+type Diagnostics struct {
+	mu               sync.Mutex
+	list             []Diagnostic
+	errors, warnings int
+	// Quiet still records warnings but doesn't print them
+	Quiet bool
+}
+
+func (d *Diagnostics) Report(diag Diagnostic) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append(d.list, diag)
+	if diag.Severity == SeverityWarning {
+		d.warnings++
+		if d.Quiet {
+			return
+		}
+	} else {
+		d.errors++
+	}
+	fmt.Fprintln(os.Stderr, diag)
+}
+
+func (d *Diagnostics) Warningf(loc Loc, token, format string, a ...interface{}) {
+	d.Report(Diagnostic{loc, SeverityWarning, token, fmt.Sprintf(format, a...)})
+}
+
+func (d *Diagnostics) Errorf(loc Loc, token, format string, a ...interface{}) {
+	d.Report(Diagnostic{loc, SeverityError, token, fmt.Sprintf(format, a...)})
+}
+
+func (d *Diagnostics) Fatalf(loc Loc, token, format string, a ...interface{}) {
+	d.Report(Diagnostic{loc, SeverityFatal, token, fmt.Sprintf(format, a...)})
+}
+
+// HasErrors is true if anything worse than a warning was reported
+func (d *Diagnostics) HasErrors() bool {
+	return d.Errors() > 0
+}
+
+// Errors returns the number of errors and fatal errors reported
+func (d *Diagnostics) Errors() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.errors
+}
+
+func (d *Diagnostics) All() []Diagnostic {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnostic(nil), d.list...)
+}
+
+func (d *Diagnostics) Summary() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return fmt.Sprintf("%d error(s), %d warning(s)", d.errors, d.warnings)
+}
@@ -3,5 +3,9 @@ package system
 import "fmt"
 
 func Error(s string) {
-    fmt.Printf("!!! Anvil has encountered an error: %s !!!\n", s)
+	fmt.Printf("!!! Anvil has encountered an error: %s !!!\n", s)
+}
+
+func Warning(s string) {
+	fmt.Printf("Anvil warning: %s\n", s)
 }
@@ -1,5 +1,157 @@
 package system
 
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
 type Options struct {
-    Desc string
+	Desc string
+	// number of worker threads, 0 uses one per core
+	NThreads int
+	// Quick trades quality for speed (lower resolution and sample counts)
+	Quick, Quiet, Verbose bool
+	// ImageFile overrides the filename given to the Film
+	ImageFile string
+	// CropWindow is the region of the image to render in NDC, [x0,x1] and [y0,y1]
+	CropWindow [2][2]float64
+	// Seed overrides the sampler seed of the scene if SeedSet, 0 is a valid seed
+	Seed    int
+	SeedSet bool
+}
+
+func NewOptions() Options {
+	return Options{Desc: "Anvil Options", CropWindow: [2][2]float64{{0, 1}, {0, 1}}}
+}
+
+// Threads returns the number of worker threads to use
+func (o Options) Threads() int {
+	if o.NThreads <= 0 {
+		return runtime.NumCPU()
+	}
+	return o.NThreads
+}
+
+// HasCropWindow is true if a crop window other than the whole image was given
+func (o Options) HasCropWindow() bool {
+	return o.CropWindow != [2][2]float64{{0, 1}, {0, 1}}
+}
+
+// ErrHelp is returned by ParseArgs when --help was given
+var ErrHelp = errors.New("help requested")
+
+func Usage() string {
+	return `usage: anvil [<options>] <filename.pbrt...>
+Files ending in .obj are rendered on their own with a camera framing the model,
+.gltf and .glb files with their own camera and lights when they have them.
+Rendering options:
+  --help               Print this help text.
+  --nthreads <num>     Use specified number of threads for rendering.
+  --outfile <filename> Write the final image to the given filename.
+  --quick              Automatically reduce a number of quality settings to
+                       render more quickly.
+  --quiet              Suppress all text output other than error messages.
+  --verbose            Print out more detailed logging information.
+  --cropwindow <x0> <x1> <y0> <y1>
+                       Specify an image crop window in NDC.
+  --seed <num>         Seed used by the samplers.
+`
+}
+
+// ParseArgs reads the command line, flags may be given as --flag or -flag and
+// flags taking a single value also accept --flag=value. Everything that isn't a
+// flag is returned as a scene file name
+func ParseArgs(args []string) (Options, []string, error) {
+	opt := NewOptions()
+	var filenames []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-" || !strings.HasPrefix(arg, "-") {
+			filenames = append(filenames, arg)
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		var inline *string
+		if eq := strings.IndexByte(name, '='); eq >= 0 {
+			v := name[eq+1:]
+			name, inline = name[:eq], &v
+		}
+
+		// value returns the argument of a flag taking a single value
+		value := func() (string, error) {
+			if inline != nil {
+				return *inline, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing value after --%s", name)
+			}
+			i++
+			return args[i], nil
+		}
+		intValue := func() (int, error) {
+			v, err := value()
+			if err != nil {
+				return 0, err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, fmt.Errorf("--%s expects an integer, got %q", name, v)
+			}
+			return n, nil
+		}
+
+		var err error
+		switch name {
+		case "help", "h":
+			return opt, nil, ErrHelp
+		case "nthreads":
+			if opt.NThreads, err = intValue(); err == nil && opt.NThreads < 0 {
+				err = fmt.Errorf("--nthreads must not be negative")
+			}
+		case "outfile":
+			opt.ImageFile, err = value()
+		case "quick":
+			opt.Quick = true
+		case "quiet":
+			opt.Quiet = true
+		case "verbose", "v":
+			opt.Verbose = true
+		case "seed":
+			opt.Seed, err = intValue()
+			opt.SeedSet = true
+		case "cropwindow":
+			if inline != nil || i+4 >= len(args) {
+				return opt, nil, fmt.Errorf("--cropwindow expects four values x0 x1 y0 y1")
+			}
+			var c [4]float64
+			for j := range c {
+				i++
+				if c[j], err = strconv.ParseFloat(args[i], 64); err != nil {
+					return opt, nil, fmt.Errorf("--cropwindow expects numbers, got %q", args[i])
+				}
+			}
+			opt.CropWindow = [2][2]float64{{c[0], c[1]}, {c[2], c[3]}}
+			for _, r := range opt.CropWindow {
+				if r[0] < 0 || r[1] > 1 || r[0] >= r[1] {
+					return opt, nil, fmt.Errorf("--cropwindow values must satisfy 0 <= x0 < x1 <= 1 and 0 <= y0 < y1 <= 1")
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown option %q", arg)
+		}
+		if err != nil {
+			return opt, nil, err
+		}
+		if inline != nil && (name == "quick" || name == "quiet" || name == "verbose" || name == "v") {
+			return opt, nil, fmt.Errorf("--%s does not take a value", name)
+		}
+	}
+	if opt.Quiet && opt.Verbose {
+		return opt, nil, fmt.Errorf("--quiet and --verbose are mutually exclusive")
+	}
+	return opt, filenames, nil
 }
@@ -0,0 +1,68 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	withOpt := func(f func(o *Options)) Options {
+		o := NewOptions()
+		f(&o)
+		return o
+	}
+	tests := []struct {
+		args  []string
+		opt   Options
+		files []string
+	}{
+		{nil, NewOptions(), nil},
+		{[]string{"a.pbrt", "-", "b.obj"}, NewOptions(), []string{"a.pbrt", "-", "b.obj"}},
+		{[]string{"--nthreads", "4", "a.pbrt"}, withOpt(func(o *Options) { o.NThreads = 4 }), []string{"a.pbrt"}},
+		{[]string{"-nthreads=3"}, withOpt(func(o *Options) { o.NThreads = 3 }), nil},
+		{[]string{"--nthreads", "0"}, NewOptions(), nil},
+		{[]string{"--seed", "0"}, withOpt(func(o *Options) { o.SeedSet = true }), nil},
+		{[]string{"--seed=-12"}, withOpt(func(o *Options) { o.Seed, o.SeedSet = -12, true }), nil},
+		{[]string{"--cropwindow", "0.1", "0.5", "0", "1", "x.pbrt"},
+			withOpt(func(o *Options) { o.CropWindow = [2][2]float64{{0.1, 0.5}, {0, 1}} }), []string{"x.pbrt"}},
+		{[]string{"--outfile", "out.exr", "--quick", "--quiet"},
+			withOpt(func(o *Options) { o.ImageFile, o.Quick, o.Quiet = "out.exr", true, true }), nil},
+		{[]string{"-v"}, withOpt(func(o *Options) { o.Verbose = true }), nil},
+	}
+	for _, test := range tests {
+		opt, files, err := ParseArgs(test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if opt != test.opt || !reflect.DeepEqual(files, test.files) {
+			t.Errorf("%q: got %+v %q, expected %+v %q", test.args, opt, files, test.opt, test.files)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--nthreads"},
+		{"--nthreads", "four"},
+		{"--nthreads", "-1"},
+		{"--seed", "1.5"},
+		{"--seed"},
+		{"--cropwindow", "0", "1", "0"},
+		{"--cropwindow", "0", "1", "0", "x"},
+		{"--cropwindow=0", "1", "0", "1"},
+		{"--cropwindow", "0.5", "0.5", "0", "1"},
+		{"--cropwindow", "0", "1.5", "0", "1"},
+		{"--cropwindow", "-0.1", "1", "0", "1"},
+		{"--quick=yes"},
+		{"--quiet", "--verbose"},
+		{"--frobnicate"},
+	} {
+		if _, _, err := ParseArgs(args); err == nil || err == ErrHelp {
+			t.Errorf("%q: expected an error, got %v", args, err)
+		}
+	}
+	if _, _, err := ParseArgs([]string{"a.pbrt", "--help"}); err != ErrHelp {
+		t.Errorf("--help: got %v, expected ErrHelp", err)
+	}
+}